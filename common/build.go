@@ -1,13 +1,14 @@
 package common
 
 import (
-	"fmt"
+	"bytes"
 	"os"
-	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/aserto-dev/mage-loot/fsutil"
 	"github.com/magefile/mage/sh"
 	"github.com/pkg/errors"
 )
@@ -20,13 +21,15 @@ const (
 )
 
 var (
-	// Architectures is a list of architectures to build binaries for.
-	Architectures = []string{"amd64", "arm"}
-	// OSList is a list of all OSes to build binaries for.
+	// Architectures is a list of architectures to build binaries for, unless the build matrix has targets.
+	Architectures = []string{"amd64", "arm64", "arm"}
+	// OSList is a list of all OSes to build binaries for, unless the build matrix has targets.
 	OSList = []string{osLinux, osWindows, osDarwin}
 )
 
-// BuildAll builds all binaries for all OSes and architectures.
+// BuildAll builds all commands for all targets of the build matrix.
+// The matrix is read from 'buildmatrix.yaml' if it exists, and can be changed using ConfigureBuild.
+// By default, it has every combination of OSList and Architectures that Go supports.
 func BuildAll(args ...string) error {
 	version, err := Version()
 	if err != nil {
@@ -36,7 +39,12 @@ func BuildAll(args ...string) error {
 	if err != nil {
 		return err
 	}
-	date := time.Now().UTC().Format(time.RFC3339)
+	date := buildDate()
+
+	matrix, err := resolveBuildMatrix()
+	if err != nil {
+		return err
+	}
 
 	UI.Normal().
 		WithStringValue("version", version).
@@ -44,48 +52,19 @@ func BuildAll(args ...string) error {
 		WithStringValue("date", date).
 		Msgf("Will build all commands.")
 
-	cmds, err := os.ReadDir("cmd")
+	cmds, err := commands(matrix)
 	if err != nil {
-		return errors.Wrap(err, "failed to read contents of './cmd' dir")
+		return err
 	}
 
+	jobs := []*buildJob{}
 	for _, c := range cmds {
-		if !c.IsDir() || strings.HasPrefix(c.Name(), ".") {
-			continue
-		}
-
-		for _, a := range Architectures {
-			for _, o := range OSList {
-				UI.Normal().
-					WithStringValue("os", o).
-					WithStringValue("arch", a).
-					WithStringValue("cmd", c.Name()).
-					Msg("Building.")
-
-				out := filepath.Join(cwd, "bin", fmt.Sprintf("%s-%s", o, a), c.Name())
-				if o == osWindows {
-					out += windowsBinExtension
-				}
-
-				err := sh.RunWithV(map[string]string{
-					"GOOS":   o,
-					"GOARCH": a,
-				},
-					"go",
-					append(
-						append([]string{"build"}, args...),
-						[]string{"-o", out, filepath.Join(cwd, "cmd", c.Name())}...,
-					)...,
-				)
-
-				if err != nil {
-					return err
-				}
-			}
+		for _, t := range matrix.TargetsFor(c.Name) {
+			jobs = append(jobs, &buildJob{cmd: c, target: t})
 		}
 	}
 
-	return nil
+	return runBuilds(newBuildSettings(matrix, version, commit, date, args), jobs)
 }
 
 // Build builds the project.
@@ -98,7 +77,12 @@ func Build(args ...string) error {
 	if err != nil {
 		return err
 	}
-	date := time.Now().UTC().Format(time.RFC3339)
+	date := buildDate()
+
+	matrix, err := resolveBuildMatrix()
+	if err != nil {
+		return err
+	}
 
 	UI.Normal().
 		WithStringValue("version", version).
@@ -106,32 +90,197 @@ func Build(args ...string) error {
 		WithStringValue("date", date).
 		Msgf("Building.")
 
-	cmds, err := os.ReadDir("cmd")
+	cmds, err := commands(matrix)
 	if err != nil {
-		return errors.Wrap(err, "failed to read contents of './cmd' dir")
+		return err
 	}
 
+	native := Target{OS: runtime.GOOS, Arch: runtime.GOARCH}
+	jobs := []*buildJob{}
 	for _, c := range cmds {
-		if !c.IsDir() || strings.HasPrefix(c.Name(), ".") {
+		jobs = append(jobs, &buildJob{cmd: c, target: native})
+	}
+
+	return runBuilds(newBuildSettings(matrix, version, commit, date, args), jobs)
+}
+
+// buildJob is a command built for a single target.
+type buildJob struct {
+	cmd      Command
+	target   Target
+	out      string
+	output   bytes.Buffer
+	cached   bool
+	err      error
+	size     int64
+	duration time.Duration
+}
+
+// buildSettings are shared by all jobs of a build.
+type buildSettings struct {
+	matrix *BuildMatrix
+	// flags are the arguments for 'go build'.
+	flags []string
+	// cacheFlags are the flags without the build date, which changes every time.
+	cacheFlags []string
+	// force rebuilds commands that didn't change.
+	force bool
+}
+
+// newBuildSettings creates the settings for building with the given args.
+// If they include '--force', or the BUILD_FORCE env var is set, all commands are rebuilt.
+func newBuildSettings(matrix *BuildMatrix, version, commit, date string, args []string) *buildSettings {
+	_, force := os.LookupEnv("BUILD_FORCE")
+
+	goArgs := []string{}
+	for _, arg := range args {
+		if arg == "--force" {
+			force = true
 			continue
 		}
+		goArgs = append(goArgs, arg)
+	}
+
+	return &buildSettings{
+		matrix:     matrix,
+		flags:      matrix.buildFlags(version, commit, date, goArgs),
+		cacheFlags: matrix.buildFlags(version, commit, "", goArgs),
+		force:      force,
+	}
+}
+
+// runBuilds runs the jobs using a pool of matrix.Parallelism workers.
+// The output of each build is printed at once when it's done, followed by a summary of all builds.
+func runBuilds(settings *buildSettings, jobs []*buildJob) error {
+	workers := settings.matrix.Parallelism
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	queue := make(chan *buildJob)
+	outputMutex := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for job := range queue {
+				job.run(settings)
+
+				outputMutex.Lock()
+				job.print()
+				outputMutex.Unlock()
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+
+	return buildSummary(jobs)
+}
+
+func (j *buildJob) run(settings *buildSettings) {
+	start := time.Now()
+	defer func() {
+		j.duration = time.Since(start)
+
+		if info, err := os.Stat(j.out); err == nil && j.err == nil {
+			j.size = info.Size()
+		}
+	}()
+
+	j.out, j.err = settings.matrix.OutputPath(j.cmd.Name, j.target)
+	if j.err != nil {
+		return
+	}
 
-		out := filepath.Join(cwd, "bin", fmt.Sprintf("%s-%s", runtime.GOOS, runtime.GOARCH), c.Name())
-		if runtime.GOOS == osWindows {
-			out += windowsBinExtension
+	env := map[string]string{}
+	if j.target.OS != runtime.GOOS || j.target.Arch != runtime.GOARCH || j.target.ARM != "" {
+		env = j.target.env()
+	}
+	if j.cmd.CGO != nil {
+		env["CGO_ENABLED"] = "0"
+		if *j.cmd.CGO {
+			env["CGO_ENABLED"] = "1"
 		}
+	}
+
+	flags, cacheFlags := settings.flags, settings.cacheFlags
+	if len(j.cmd.Tags) != 0 {
+		tags := "-tags=" + strings.Join(j.cmd.Tags, ",")
+		flags = append(append([]string{}, flags...), tags)
+		cacheFlags = append(append([]string{}, cacheFlags...), tags)
+	}
+
+	// If the cache key can't be computed, the command is built anyway and 'go build' reports any problems.
+	key, keyErr := buildCacheKey(env, j.cmd.Dir, j.cmd.Package, j.out, cacheFlags)
+	if keyErr == nil && !settings.force && isBuildCached(j.cmd.Name, j.target, j.out, key) {
+		j.cached = true
+		return
+	}
+
+	// '-C' runs the build in the command's module, which can be another one than the working directory's.
+	_, j.err = sh.Exec(env, &j.output, &j.output,
+		"go",
+		append(
+			append([]string{"-C", j.cmd.Dir, "build"}, flags...),
+			[]string{"-o", j.out, j.cmd.Package}...,
+		)...,
+	)
+	if j.err != nil || keyErr != nil {
+		return
+	}
+
+	j.err = storeBuildCacheKey(j.cmd.Name, j.target, key)
+}
+
+func (j *buildJob) print() {
+	switch {
+	case j.err != nil:
+		UI.Problem().WithStringValue("target", j.target.String()).WithStringValue("cmd", j.cmd.Name).Msg("Build failed.")
+	case j.cached:
+		UI.Normal().WithStringValue("target", j.target.String()).WithStringValue("cmd", j.cmd.Name).Msg("Unchanged, skipped.")
+	default:
+		UI.Normal().WithStringValue("target", j.target.String()).WithStringValue("cmd", j.cmd.Name).Msg("Built.")
+	}
+
+	// The output follows the message, so a failed build's output goes to the error output.
+	out := UI.Output()
+	if j.err != nil {
+		out = UI.Err()
+	}
+	if j.output.Len() != 0 {
+		_, _ = j.output.WriteTo(out)
+	}
+}
 
-		err := sh.RunV(
-			"go",
-			append(
-				append([]string{"build"}, args...),
-				[]string{"-o", out, filepath.Join(cwd, "cmd", c.Name())}...,
-			)...,
-		)
+// buildSummary prints a table of all builds and returns an error if any of them failed.
+func buildSummary(jobs []*buildJob) error {
+	table := UI.Normal().WithTable("Cmd", "Target", "Status", "Size", "Duration")
 
-		if err != nil {
-			return err
+	failed := []string{}
+	for _, j := range jobs {
+		status, size := "ok", fsutil.FormatSize(j.size)
+		switch {
+		case j.err != nil:
+			status, size = "failed", "-"
+			failed = append(failed, j.cmd.Name+" ("+j.target.String()+")")
+		case j.cached:
+			status = "unchanged"
 		}
+
+		table.WithTableRow(j.cmd.Name, j.target.String(), status, size, j.duration.Round(time.Millisecond).String())
+	}
+	table.Do()
+
+	if len(failed) != 0 {
+		return errors.Errorf("%d of %d builds failed: %s", len(failed), len(jobs), strings.Join(failed, ", "))
 	}
 
 	return nil
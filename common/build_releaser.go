@@ -1,16 +1,16 @@
 package common
 
-import (
-	"github.com/aserto-dev/mage-loot/deps"
-)
-
 // BuildAllReleaser builds all binaries for all OSes and architectures, in preparation for a release.
 func BuildAllReleaser(args ...string) error {
 	err := GitleaksCheck()
 	if err != nil {
 		return err
 	}
-	return deps.GoDep("goreleaser")(append([]string{"build", "--clean"}, args...)...)
+	err = goreleaserCheck(args)
+	if err != nil {
+		return err
+	}
+	return goreleaser(append([]string{"build", "--clean"}, args...)...)
 }
 
 // BuildReleaser builds the project.
@@ -19,11 +19,19 @@ func BuildReleaser(args ...string) error {
 	if err != nil {
 		return err
 	}
+	err = goreleaserCheck(args)
+	if err != nil {
+		return err
+	}
 
-	return deps.GoDep("goreleaser")(append([]string{"build", "--clean", "--snapshot", "--single-target"}, args...)...)
+	return goreleaser(append([]string{"build", "--clean", "--snapshot", "--single-target"}, args...)...)
 }
 
 // Release releases the project.
 func Release(args ...string) error {
-	return deps.GoDep("goreleaser")(append([]string{"release"}, args...)...)
+	if err := goreleaserCheck(args); err != nil {
+		return err
+	}
+
+	return goreleaser(append([]string{"release"}, args...)...)
 }
@@ -0,0 +1,84 @@
+package common_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aserto-dev/clui"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/mage-loot/common"
+)
+
+// captureOutput returns what f prints using common.UI, to its output and error output.
+func captureOutput(t *testing.T, f func()) string {
+	t.Helper()
+
+	var out bytes.Buffer
+	ui := common.UI
+	common.UI = clui.NewUIWithOutputErrorAndInput(&out, &out, os.Stdin)
+	defer func() { common.UI = ui }()
+
+	f()
+
+	return out.String()
+}
+
+// lineRange returns the first and last index of the lines containing s.
+func lineRange(lines []string, s string) (int, int) {
+	first, last := -1, -1
+	for i, l := range lines {
+		if strings.Contains(l, s) {
+			if first == -1 {
+				first = i
+			}
+			last = i
+		}
+	}
+
+	return first, last
+}
+
+func TestRunBuilds(t *testing.T) {
+	assert := require.New(t)
+
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module example.com/app\n\ngo 1.22\n")
+	// The temp dir makes the package unique, so it isn't in the go build cache and '-v' prints it.
+	writeFile(t, dir, "cmd/good/main.go", "package main\n\nvar dir = "+strconv.Quote(dir)+"\n\nfunc main() { println(dir) }\n")
+	writeFile(t, dir, "cmd/bad/main.go", "package main\n\nfunc main() { missing() }\n")
+
+	defer common.SetWorkDir(dir)()
+	t.Setenv("GOFLAGS", "")
+
+	cmds := []common.Command{
+		{Name: "bad", Package: "./cmd/bad", Dir: dir},
+		{Name: "good", Package: "./cmd/good", Dir: dir},
+	}
+
+	var err error
+	// '-v' makes both builds print the packages they compile.
+	out := captureOutput(t, func() {
+		err = common.RunBuilds(&common.BuildMatrix{Parallelism: 2}, cmds, "-v", "--force")
+	})
+
+	assert.ErrorContains(err, "1 of 2 builds failed: bad (")
+	assert.NotContains(err.Error(), "good")
+
+	matches, globErr := filepath.Glob(filepath.Join(dir, "bin", "*", "good*"))
+	assert.NoError(globErr)
+	assert.Len(matches, 1, "the good command is built even though the bad one fails")
+
+	lines := strings.Split(out, "\n")
+	badFirst, badLast := lineRange(lines, "cmd/bad")
+	goodFirst, goodLast := lineRange(lines, "cmd/good")
+	assert.NotEqual(-1, badFirst, out)
+	assert.NotEqual(-1, goodFirst, out)
+	assert.Contains(out, "undefined: missing")
+	assert.Contains(out, "Build failed.")
+	assert.True(badLast < goodFirst || goodLast < badFirst, "the output of the builds is interleaved:\n%s", out)
+}
@@ -0,0 +1,229 @@
+package common
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aserto-dev/mage-loot/fsutil"
+	"github.com/pkg/errors"
+)
+
+var (
+	// buildCacheDir holds the cache key of the last build of every command and target.
+	buildCacheDir = filepath.Join(".ext", "build")
+
+	// ambientBuildEnv are go env vars that change the binary, even if they're only set in the environment.
+	ambientBuildEnv = []string{"GOFLAGS", "CGO_ENABLED", "GOEXPERIMENT", "GOAMD64"}
+)
+
+// listedPackage are the fields of 'go list -json' needed to hash a package's sources.
+type listedPackage struct {
+	Dir      string
+	Standard bool
+	Module   *struct {
+		Path    string
+		Version string
+		Main    bool
+		Replace *struct{}
+	}
+	GoFiles    []string
+	CgoFiles   []string
+	CFiles     []string
+	CXXFiles   []string
+	HFiles     []string
+	SFiles     []string
+	SysoFiles  []string
+	EmbedFiles []string
+}
+
+// buildCacheKey hashes everything that affects the binary of a package: the source files of all
+// packages it depends on (as listed by 'go list -deps' for the target), go.mod and go.sum (and go.work
+// and go.work.sum in a workspace), the build flags, the target env, the ambient go env (like GOFLAGS)
+// and the go version.
+// Dependencies from the module cache are identified by their version.
+func buildCacheKey(env map[string]string, dir, pkg, out string, flags []string) (string, error) {
+	hasher := sha256.New()
+
+	goVersion, err := goOutput(env, dir, "version")
+	if err != nil {
+		return "", err
+	}
+	writeKeyPart(hasher, "go", goVersion)
+
+	// 'go env' resolves the values go builds with, from the environment, the target env and 'go env -w'.
+	goEnv, err := goOutput(env, dir, append([]string{"env"}, ambientBuildEnv...)...)
+	if err != nil {
+		return "", err
+	}
+	writeKeyPart(hasher, "goenv", goEnv)
+	writeKeyPart(hasher, "out", out)
+	writeKeyPart(hasher, "flags", strings.Join(flags, "\x00"))
+
+	envKeys := make([]string, 0, len(env))
+	for k := range env {
+		envKeys = append(envKeys, k)
+	}
+	sort.Strings(envKeys)
+	for _, k := range envKeys {
+		writeKeyPart(hasher, "env", k+"="+env[k])
+	}
+
+	// Directives like 'replace' or 'toolchain' change the binary without changing go.sum.
+	modFiles, err := moduleFiles(env, dir)
+	if err != nil {
+		return "", err
+	}
+	for _, f := range modFiles {
+		writeKeyPart(hasher, "modfile", f)
+		if err := hashFileInto(hasher, f); err != nil && !os.IsNotExist(errors.Cause(err)) {
+			return "", err
+		}
+	}
+
+	listed, err := goOutput(env, dir, append([]string{"list", "-deps", "-json"}, append(tagFlags(flags), pkg)...)...)
+	if err != nil {
+		return "", err
+	}
+
+	dec := json.NewDecoder(strings.NewReader(listed))
+	for dec.More() {
+		var p listedPackage
+		if err := dec.Decode(&p); err != nil {
+			return "", errors.Wrap(err, "failed to parse 'go list' output")
+		}
+
+		if p.Standard {
+			continue
+		}
+		if p.Module != nil && !p.Module.Main && p.Module.Replace == nil && p.Module.Version != "" {
+			writeKeyPart(hasher, "module", p.Module.Path+"@"+p.Module.Version)
+			continue
+		}
+
+		files := [][]string{p.GoFiles, p.CgoFiles, p.CFiles, p.CXXFiles, p.HFiles, p.SFiles, p.SysoFiles, p.EmbedFiles}
+		for _, group := range files {
+			for _, f := range group {
+				writeKeyPart(hasher, "file", filepath.Join(p.Dir, f))
+				if err := hashFileInto(hasher, filepath.Join(p.Dir, f)); err != nil {
+					return "", err
+				}
+			}
+		}
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// moduleFiles returns the go.mod and go.sum of the module in dir, and the go.work and go.work.sum
+// of its workspace if there is one. The sum files don't have to exist.
+func moduleFiles(env map[string]string, dir string) ([]string, error) {
+	out, err := goOutput(env, dir, "env", "GOMOD", "GOWORK")
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if goMod := strings.TrimSpace(lines[0]); goMod != "" && goMod != os.DevNull {
+		files = append(files, goMod, filepath.Join(filepath.Dir(goMod), "go.sum"))
+	}
+	if len(lines) > 1 {
+		if goWork := strings.TrimSpace(lines[1]); goWork != "" && goWork != "off" {
+			files = append(files, goWork, goWork+".sum")
+		}
+	}
+
+	return files, nil
+}
+
+// tagFlags returns the flags that change which files 'go list' selects.
+func tagFlags(flags []string) []string {
+	tags := []string{}
+	for i, f := range flags {
+		switch {
+		case strings.HasPrefix(f, "-tags="):
+			tags = append(tags, f)
+		case f == "-tags" && i+1 < len(flags):
+			tags = append(tags, "-tags="+flags[i+1])
+		}
+	}
+
+	return tags
+}
+
+// goOutput runs go in dir, with the env vars added to the environment, and returns its output.
+func goOutput(env map[string]string, dir string, args ...string) (string, error) {
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.Wrapf(err, "'go %s' failed: %s", strings.Join(args, " "), stderr.String())
+	}
+
+	return string(out), nil
+}
+
+func writeKeyPart(w io.Writer, kind, value string) {
+	_, _ = io.WriteString(w, kind+"\x00"+value+"\x00")
+}
+
+func hashFileInto(w io.Writer, filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open '%s'", filePath)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(w, f); err != nil {
+		return errors.Wrapf(err, "failed to hash '%s'", filePath)
+	}
+
+	return nil
+}
+
+func buildCachePath(cmd string, t Target) string {
+	return filepath.Join(cwd, buildCacheDir, cmd+"-"+strings.ReplaceAll(t.String(), "/", "-")+".sha256")
+}
+
+// isBuildCached returns true if the binary exists and was built with the same cache key.
+func isBuildCached(cmd string, t Target, out, key string) bool {
+	if exists, _ := fsutil.FileExists(out); !exists {
+		return false
+	}
+
+	stored, err := os.ReadFile(buildCachePath(cmd, t))
+	if err != nil {
+		return false
+	}
+
+	return strings.TrimSpace(string(stored)) == key
+}
+
+func storeBuildCacheKey(cmd string, t Target, key string) error {
+	cachePath := buildCachePath(cmd, t)
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0700); err != nil {
+		return errors.Wrapf(err, "failed to create '%s'", filepath.Dir(cachePath))
+	}
+
+	if err := os.WriteFile(cachePath, []byte(key+"\n"), 0600); err != nil {
+		return errors.Wrapf(err, "failed to write '%s'", cachePath)
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package common_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/mage-loot/common"
+)
+
+func TestBuildCacheKey(t *testing.T) {
+	assert := require.New(t)
+
+	key := func(env map[string]string, flags ...string) string {
+		k, err := common.BuildCacheKey(env, "..", "./semver", "bin/semver", flags)
+		assert.NoError(err)
+		return k
+	}
+
+	base := key(map[string]string{})
+	assert.Equal(base, key(map[string]string{}))
+	assert.NotEqual(base, key(map[string]string{}, "-trimpath"))
+	assert.NotEqual(base, key(map[string]string{"GOOS": "windows", "GOARCH": "amd64"}))
+
+	// Settings that are only in the environment also change the binary.
+	ambient := map[string][2]string{"GOFLAGS": {"", "-trimpath"}, "CGO_ENABLED": {"0", "1"}, "GOAMD64": {"v1", "v3"}}
+	for k, values := range ambient {
+		t.Run(k, func(t *testing.T) {
+			t.Setenv(k, values[0])
+			before := key(map[string]string{})
+			t.Setenv(k, values[1])
+			require.NotEqual(t, before, key(map[string]string{}))
+		})
+	}
+}
+
+func TestBuildCacheKeyModuleFiles(t *testing.T) {
+	assert := require.New(t)
+
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module example.com/app\n\ngo 1.22\n")
+	writeFile(t, dir, "main.go", "package main\n\nfunc main() {}\n")
+	t.Setenv("GOWORK", "")
+	t.Setenv("GOFLAGS", "")
+
+	key := func() string {
+		k, err := common.BuildCacheKey(map[string]string{}, dir, ".", "bin/app", nil)
+		assert.NoError(err)
+		return k
+	}
+
+	base := key()
+
+	// Directives in go.mod change the binary without changing go.sum.
+	writeFile(t, dir, "go.mod", "module example.com/app\n\ngo 1.22\n\nretract v1.0.0\n")
+	retracted := key()
+	assert.NotEqual(base, retracted)
+
+	writeFile(t, dir, "go.work", "go 1.22\n\nuse .\n")
+	assert.NotEqual(retracted, key())
+}
@@ -0,0 +1,191 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/aserto-dev/mage-loot/semver"
+	"github.com/pkg/errors"
+)
+
+const (
+	// BumpAuto makes NextVersion pick the part to increment from the commits since the last tag.
+	BumpAuto = "auto"
+	// ChangelogFile is the file WriteChangelog adds sections to.
+	ChangelogFile = "CHANGELOG.md"
+
+	changelogTitle = "# Changelog"
+	// commitSeparator separates commits in the output of 'git log', as messages can contain blank lines.
+	commitSeparator = "\x1e"
+)
+
+var (
+	conventionalHeaderRegex = regexp.MustCompile(`^(\w+)(?:\(([^)]*)\))?(!)?: (.+)$`)
+	breakingFooterRegex     = regexp.MustCompile(`(?m)^BREAKING[ -]CHANGE: `)
+
+	// changelogGroups are the commit types listed in the changelog, in order. Other types are left out.
+	changelogGroups = []struct {
+		commitType string
+		title      string
+	}{
+		{"feat", "Features"},
+		{"fix", "Bug Fixes"},
+		{"perf", "Performance Improvements"},
+		{"revert", "Reverts"},
+	}
+)
+
+// ConventionalCommit is a commit whose message follows the Conventional Commits spec,
+// like 'feat(api)!: remove the v1 endpoints'.
+type ConventionalCommit struct {
+	Hash    string
+	Type    string
+	Scope   string
+	Subject string
+	// Breaking is true if the type is followed by '!' or there's a 'BREAKING CHANGE:' footer.
+	Breaking bool
+}
+
+// ParseConventionalCommit parses the message of a commit. It returns false if the header
+// of the message doesn't follow the Conventional Commits spec.
+func ParseConventionalCommit(hash, message string) (ConventionalCommit, bool) {
+	header, body, _ := strings.Cut(strings.TrimSpace(message), "\n")
+
+	m := conventionalHeaderRegex.FindStringSubmatch(strings.TrimSpace(header))
+	if m == nil {
+		return ConventionalCommit{}, false
+	}
+
+	return ConventionalCommit{
+		Hash:     hash,
+		Type:     strings.ToLower(m[1]),
+		Scope:    m[2],
+		Subject:  strings.TrimSpace(m[4]),
+		Breaking: m[3] == "!" || breakingFooterRegex.MatchString(body),
+	}, true
+}
+
+// CommitsSinceLatestTag returns the conventional commits between the highest semver tag and HEAD,
+// newest first. Commits that don't follow the spec are skipped.
+func CommitsSinceLatestTag(options ...VersionOption) ([]ConventionalCommit, error) {
+	tag, _, err := LatestVersionTag(options...)
+	if err != nil {
+		return nil, err
+	}
+
+	revs := "HEAD"
+	if tag != "" {
+		revs = tag + "..HEAD"
+	}
+
+	out, err := gitOutput("log", "--format=%H%x00%B"+commitSeparator, revs)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list commits")
+	}
+
+	commits := []ConventionalCommit{}
+	for _, entry := range strings.Split(out, commitSeparator) {
+		hash, message, ok := strings.Cut(strings.TrimSpace(entry), "\x00")
+		if !ok {
+			continue
+		}
+		if c, ok := ParseConventionalCommit(hash, message); ok {
+			commits = append(commits, c)
+		}
+	}
+
+	return commits, nil
+}
+
+// BumpFor returns the part of the version the commits call for: 'major' if any is a breaking change,
+// 'minor' if any is a feature and 'patch' otherwise.
+func BumpFor(commits []ConventionalCommit) string {
+	part := semver.PartPatch
+	for _, c := range commits {
+		if c.Breaking {
+			return semver.PartMajor
+		}
+		if c.Type == "feat" {
+			part = semver.PartMinor
+		}
+	}
+
+	return part
+}
+
+// WriteChangelog adds a section for the version to the top of CHANGELOG.md, listing the
+// breaking changes, features, bug fixes, performance improvements and reverts since the last tag.
+// The file is created if it doesn't exist. The date of the section honors SOURCE_DATE_EPOCH.
+func WriteChangelog(version string, options ...VersionOption) error {
+	commits, err := CommitsSinceLatestTag(options...)
+	if err != nil {
+		return err
+	}
+
+	changelogPath := filepath.Join(cwd, ChangelogFile)
+	existing, err := os.ReadFile(changelogPath)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "failed to read '%s'", changelogPath)
+	}
+
+	previous := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(string(existing)), changelogTitle))
+	content := changelogTitle + "\n\n" + changelogSection(version, commits)
+	if previous != "" {
+		content += "\n" + previous + "\n"
+	}
+
+	if err := os.WriteFile(changelogPath, []byte(content), 0644); err != nil { //nolint:gosec // the changelog is committed
+		return errors.Wrapf(err, "failed to write '%s'", changelogPath)
+	}
+
+	UI.Normal().WithStringValue("version", version).WithIntValue("commits", int64(len(commits))).Msg("Updated changelog.")
+
+	return nil
+}
+
+// changelogSection renders the commits of a version, grouped by type.
+func changelogSection(version string, commits []ConventionalCommit) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "## %s (%s)\n", version, sourceDate().Format("2006-01-02"))
+
+	writeGroup := func(title string, matches func(ConventionalCommit) bool) {
+		entries := []string{}
+		for _, c := range commits {
+			if matches(c) {
+				entries = append(entries, changelogEntry(c))
+			}
+		}
+		if len(entries) == 0 {
+			return
+		}
+
+		fmt.Fprintf(&sb, "\n### %s\n\n", title)
+		for _, e := range entries {
+			sb.WriteString("* " + e + "\n")
+		}
+	}
+
+	writeGroup("BREAKING CHANGES", func(c ConventionalCommit) bool { return c.Breaking })
+	for _, g := range changelogGroups {
+		commitType := g.commitType
+		writeGroup(g.title, func(c ConventionalCommit) bool { return c.Type == commitType })
+	}
+
+	return sb.String()
+}
+
+func changelogEntry(c ConventionalCommit) string {
+	hash := c.Hash
+	if len(hash) > 7 {
+		hash = hash[:7]
+	}
+
+	if c.Scope != "" {
+		return fmt.Sprintf("**%s:** %s (%s)", c.Scope, c.Subject, hash)
+	}
+
+	return fmt.Sprintf("%s (%s)", c.Subject, hash)
+}
@@ -0,0 +1,81 @@
+package common_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/mage-loot/common"
+)
+
+func TestParseConventionalCommit(t *testing.T) {
+	assert := require.New(t)
+
+	c, ok := common.ParseConventionalCommit("abc", "feat(api)!: drop v1\n\nbody")
+	assert.True(ok)
+	assert.Equal(common.ConventionalCommit{Hash: "abc", Type: "feat", Scope: "api", Subject: "drop v1", Breaking: true}, c)
+
+	c, ok = common.ParseConventionalCommit("abc", "fix: handle nil\n\nBREAKING CHANGE: Config is required")
+	assert.True(ok)
+	assert.True(c.Breaking)
+	assert.Equal("fix", c.Type)
+
+	_, ok = common.ParseConventionalCommit("abc", "Update the readme")
+	assert.False(ok)
+}
+
+func TestBumpFor(t *testing.T) {
+	assert := require.New(t)
+
+	assert.Equal("patch", common.BumpFor(nil))
+	assert.Equal("patch", common.BumpFor([]common.ConventionalCommit{{Type: "fix"}, {Type: "chore"}}))
+	assert.Equal("minor", common.BumpFor([]common.ConventionalCommit{{Type: "fix"}, {Type: "feat"}}))
+	assert.Equal("major", common.BumpFor([]common.ConventionalCommit{{Type: "feat"}, {Type: "chore", Breaking: true}}))
+}
+
+func TestChangelogSinceLatestTag(t *testing.T) {
+	assert := require.New(t)
+	dir := gitRepo(t)
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+
+	git(t, dir, "commit", "-q", "--allow-empty", "-m", "feat: not released yet, but before the tag")
+	git(t, dir, "tag", "v1.2.3")
+	git(t, dir, "commit", "-q", "--allow-empty", "-m", "fix(deps): verify checksums")
+	git(t, dir, "commit", "-q", "--allow-empty", "-m", "chore: bump tools")
+	git(t, dir, "commit", "-q", "--allow-empty", "-m", "Merge something unconventional")
+	git(t, dir, "commit", "-q", "--allow-empty", "-m", "feat: add packaging\n\nWith checksums.")
+
+	commits, err := common.CommitsSinceLatestTag()
+	assert.NoError(err)
+	assert.Len(commits, 3)
+	assert.Equal("add packaging", commits[0].Subject)
+
+	next, err := common.NextVersion(common.BumpAuto)
+	assert.NoError(err)
+	assert.Equal("1.3.0", next)
+
+	writeFile(t, dir, common.ChangelogFile, "# Changelog\n\n## 1.2.3 (2023-01-01)\n\n* old entry\n")
+	assert.NoError(common.WriteChangelog(next))
+
+	changelog, err := os.ReadFile(filepath.Join(dir, common.ChangelogFile))
+	assert.NoError(err)
+
+	hashes := strings.Fields(git(t, dir, "log", "-4", "--format=%H"))
+	fix, feat := hashes[3][:7], hashes[0][:7]
+	assert.Equal("# Changelog\n\n"+
+		"## 1.3.0 (2023-11-14)\n\n"+
+		"### Features\n\n"+
+		"* add packaging ("+feat+")\n\n"+
+		"### Bug Fixes\n\n"+
+		"* **deps:** verify checksums ("+fix+")\n\n"+
+		"## 1.2.3 (2023-01-01)\n\n"+
+		"* old entry\n", string(changelog))
+
+	git(t, dir, "commit", "-q", "--allow-empty", "-m", "refactor!: rename options")
+	next, err = common.NextVersion(common.BumpAuto)
+	assert.NoError(err)
+	assert.Equal("2.0.0", next)
+}
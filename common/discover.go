@@ -0,0 +1,153 @@
+package common
+
+import (
+	"encoding/json"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aserto-dev/mage-loot/fsutil"
+	"github.com/pkg/errors"
+)
+
+// defaultPackages are the patterns main packages are discovered with, unless the build matrix has its own.
+var defaultPackages = []string{"./..."}
+
+// Command is a main package built by Build and BuildAll.
+type Command struct {
+	// Name is the name of the binary, which defaults to the last element of the package path.
+	// It's also the name used in the 'commands' of the build matrix.
+	Name string `yaml:"name"`
+	// Package is the package to build, as an import path or a path like './cmd/app' relative to Dir.
+	Package string `yaml:"package"`
+	// Dir is the directory of the module the package is in, relative to the working directory.
+	Dir string `yaml:"dir"`
+	// Tags are build tags. They replace any '-tags' passed to Build or BuildAll.
+	Tags []string `yaml:"tags"`
+	// CGO sets CGO_ENABLED, if it isn't nil.
+	CGO *bool `yaml:"cgo"`
+}
+
+// WithCommands sets the commands to build, instead of discovering them.
+func WithCommands(cmds ...Command) BuildOption {
+	return func(m *BuildMatrix) {
+		m.Binaries = cmds
+	}
+}
+
+// WithPackages sets the patterns main packages are discovered with, like './cmd/...'.
+func WithPackages(patterns ...string) BuildOption {
+	return func(m *BuildMatrix) {
+		m.Packages = patterns
+	}
+}
+
+// commands returns the commands to build, which are either listed in the build matrix,
+// or are the main packages matching its package patterns in every module of the workspace.
+func commands(matrix *BuildMatrix) ([]Command, error) {
+	cmds := []Command{}
+
+	if len(matrix.Binaries) != 0 {
+		for _, c := range matrix.Binaries {
+			if c.Package == "" {
+				return nil, errors.Errorf("command '%s' has no package", c.Name)
+			}
+			if c.Name == "" {
+				c.Name = path.Base(c.Package)
+			}
+			c.Dir = moduleDir(c.Dir)
+			cmds = append(cmds, c)
+		}
+	} else {
+		patterns := matrix.Packages
+		if len(patterns) == 0 {
+			patterns = defaultPackages
+		}
+
+		modules, err := workspaceModules()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, dir := range modules {
+			discovered, err := mainPackages(dir, patterns)
+			if err != nil {
+				return nil, err
+			}
+			cmds = append(cmds, discovered...)
+		}
+	}
+
+	names := map[string]string{}
+	for _, c := range cmds {
+		if other, ok := names[c.Name]; ok {
+			return nil, errors.Errorf("commands '%s' and '%s' are both named '%s'", other, c.Package, c.Name)
+		}
+		names[c.Name] = c.Package
+	}
+
+	sort.Slice(cmds, func(i, j int) bool {
+		return cmds[i].Name < cmds[j].Name
+	})
+
+	return cmds, nil
+}
+
+// moduleDir returns the absolute path of a module directory relative to the working directory.
+func moduleDir(dir string) string {
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+
+	return filepath.Join(cwd, dir)
+}
+
+// workspaceModules returns the directories of the modules in the go.work file,
+// or only the working directory if there's none.
+func workspaceModules() ([]string, error) {
+	if exists, _ := fsutil.FileExists(filepath.Join(cwd, "go.work")); !exists {
+		return []string{cwd}, nil
+	}
+
+	out, err := goOutput(nil, cwd, "work", "edit", "-json")
+	if err != nil {
+		return nil, err
+	}
+
+	var work struct {
+		Use []struct {
+			DiskPath string
+		}
+	}
+	if err := json.Unmarshal([]byte(out), &work); err != nil {
+		return nil, errors.Wrap(err, "failed to parse go.work")
+	}
+
+	dirs := []string{}
+	for _, use := range work.Use {
+		dirs = append(dirs, moduleDir(use.DiskPath))
+	}
+
+	return dirs, nil
+}
+
+// mainPackages lists the main packages matching the patterns in the module in dir.
+// Patterns that match nothing in a module are ignored, and packages that fail to build are reported by the build.
+func mainPackages(dir string, patterns []string) ([]Command, error) {
+	out, err := goOutput(nil, dir, append([]string{"list", "-e", "-f", `{{if eq .Name "main"}}{{.ImportPath}}{{end}}`}, patterns...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	cmds := []Command{}
+	for _, importPath := range strings.Split(out, "\n") {
+		importPath = strings.TrimSpace(importPath)
+		if importPath == "" {
+			continue
+		}
+		cmds = append(cmds, Command{Name: path.Base(importPath), Package: importPath, Dir: dir})
+	}
+
+	return cmds, nil
+}
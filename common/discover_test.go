@@ -0,0 +1,68 @@
+package common_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/mage-loot/common"
+)
+
+func TestDiscoverWorkspaceCommands(t *testing.T) {
+	assert := require.New(t)
+
+	dir := t.TempDir()
+	writeFile(t, dir, "go.work", "go 1.22\n\nuse (\n\t./app\n\t./tools\n)\n")
+	writeFile(t, dir, "app/go.mod", "module example.com/app\n\ngo 1.22\n")
+	writeFile(t, dir, "app/cmd/server/main.go", "package main\n\nfunc main() {}\n")
+	writeFile(t, dir, "app/pkg/lib/lib.go", "package lib\n")
+	writeFile(t, dir, "tools/go.mod", "module example.com/tools\n\ngo 1.22\n")
+	writeFile(t, dir, "tools/gen/main.go", "package main\n\nfunc main() {}\n")
+
+	defer common.SetWorkDir(dir)()
+	// '-mod=mod' can't be used in workspace mode.
+	t.Setenv("GOFLAGS", "")
+
+	cmds, err := common.Commands(&common.BuildMatrix{})
+	assert.NoError(err)
+	assert.Equal([]common.Command{
+		{Name: "gen", Package: "example.com/tools/gen", Dir: filepath.Join(dir, "tools")},
+		{Name: "server", Package: "example.com/app/cmd/server", Dir: filepath.Join(dir, "app")},
+	}, cmds)
+
+	cmds, err = common.Commands(&common.BuildMatrix{Packages: []string{"./cmd/..."}})
+	assert.NoError(err)
+	assert.Len(cmds, 1)
+	assert.Equal("server", cmds[0].Name)
+}
+
+func TestExplicitCommands(t *testing.T) {
+	assert := require.New(t)
+	defer common.SetWorkDir(t.TempDir())()
+
+	cgo := false
+	m := &common.BuildMatrix{}
+	common.WithCommands(
+		common.Command{Package: "./cmd/server", Tags: []string{"netgo"}, CGO: &cgo},
+		common.Command{Name: "server-debug", Package: "./cmd/server", Tags: []string{"debug"}},
+	)(m)
+
+	cmds, err := common.Commands(m)
+	assert.NoError(err)
+	assert.Equal([]string{"server", "server-debug"}, []string{cmds[0].Name, cmds[1].Name})
+	assert.Equal(common.WorkDir(), cmds[0].Dir)
+
+	common.WithCommands(common.Command{Package: "./a/server"}, common.Command{Package: "./b/server"})(m)
+	_, err = common.Commands(m)
+	assert.ErrorContains(err, "both named 'server'")
+}
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+
+	filePath := filepath.Join(dir, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(filePath), 0700))
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0600))
+}
@@ -1,14 +1,11 @@
 package common
 
 import (
-	"bufio"
 	"fmt"
 	"os"
 	"runtime"
-	"strings"
 	"time"
 
-	"github.com/aserto-dev/mage-loot/deps"
 	"github.com/magefile/mage/sh"
 	"github.com/pkg/errors"
 )
@@ -25,27 +22,6 @@ func DockerPush(existingImage, imageToPush string) error {
 	return sh.RunV("docker", "push", imageToPush)
 }
 
-// DockerTags uses sver to get a list of tags to be pushed.
-// Expects env vars DOCKER_USERNAME and DOCKER_PASSWORD to be set.
-func DockerTags(registry, image string) ([]string, error) {
-	user := os.ExpandEnv("$DOCKER_USERNAME")
-	password := os.ExpandEnv("$DOCKER_PASSWORD")
-
-	out, err := deps.GoDepOutput("sver")("tags", "-u", user, "-p", password, "-s", registry, image)
-	if err != nil {
-		return nil, errors.Wrapf(err, "failed to read tags in registry: %s", out)
-	}
-
-	result := []string{}
-
-	scanner := bufio.NewScanner(strings.NewReader(out))
-	for scanner.Scan() {
-		result = append(result, scanner.Text())
-	}
-
-	return result, nil
-}
-
 // DockerImage builds the docker image for the project.
 func DockerImage(repositoryAndTag string, args ...string) error {
 	version, err := Version()
@@ -0,0 +1,110 @@
+package common
+
+import (
+	"runtime"
+
+	"github.com/zricethezav/gitleaks/v8/detect"
+	"github.com/zricethezav/gitleaks/v8/report"
+)
+
+// BuildFlags exposes buildFlags, for tests.
+func (m *BuildMatrix) BuildFlags(version, commit, date string, args []string) []string {
+	return m.buildFlags(version, commit, date, args)
+}
+
+// BuildCacheKey exposes buildCacheKey, for tests.
+func BuildCacheKey(env map[string]string, dir, pkg, out string, flags []string) (string, error) {
+	return buildCacheKey(env, dir, pkg, out, flags)
+}
+
+// RunBuilds builds the commands for the native target, for tests.
+func RunBuilds(m *BuildMatrix, cmds []Command, args ...string) error {
+	jobs := []*buildJob{}
+	for _, c := range cmds {
+		jobs = append(jobs, &buildJob{cmd: c, target: Target{OS: runtime.GOOS, Arch: runtime.GOARCH}})
+	}
+
+	return runBuilds(newBuildSettings(m, "1.0.0", "abc", "", args), jobs)
+}
+
+// SetWorkDir changes the working directory used by builds, for tests.
+// It returns a function that restores the previous one.
+func SetWorkDir(dir string) func() {
+	previous := cwd
+	cwd = dir
+
+	return func() {
+		cwd = previous
+	}
+}
+
+// Commands exposes commands, for tests.
+func Commands(m *BuildMatrix) ([]Command, error) {
+	return commands(m)
+}
+
+// DockerTagsFor exposes dockerTagsFor, for tests.
+func DockerTagsFor(version string, existing []string) ([]string, error) {
+	return dockerTagsFor(version, existing)
+}
+
+// RegistryTags exposes registryTags, for tests.
+func RegistryTags(registry, image, user, password string) ([]string, error) {
+	return registryTags(registry, image, user, password)
+}
+
+// SetReleaseOptions replaces the options set using ConfigureRelease, and returns a func that restores them.
+func SetReleaseOptions(options ...ReleaseOption) func() {
+	previous := releaseOptions
+	releaseOptions = options
+
+	return func() {
+		releaseOptions = previous
+	}
+}
+
+// GitleaksFindings exposes gitleaksFindings, for tests.
+func GitleaksFindings() ([]report.Finding, error) {
+	findings, _, err := gitleaksFindings(&gitleaksScan{mode: gitleaksUnstaged}, true)
+	return findings, err
+}
+
+// DetectBuiltinLeaks scans content using only the rules in GitleakConfig, for tests.
+func DetectBuiltinLeaks(content string) ([]report.Finding, error) {
+	vc, err := parseGitleaksConfig(GitleakConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := vc.Translate()
+	if err != nil {
+		return nil, err
+	}
+
+	return detect.NewDetector(cfg).DetectString(content), nil
+}
+
+// BuiltinGitleaksRuleIDs returns the IDs of the rules in GitleakConfig, for tests.
+func BuiltinGitleaksRuleIDs() ([]string, error) {
+	vc, err := parseGitleaksConfig(GitleakConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, r := range vc.Rules {
+		ids = append(ids, r.ID)
+	}
+
+	return ids, nil
+}
+
+// SetGoreleaser replaces running the goreleaser dependency, and returns a func that restores it.
+func SetGoreleaser(run func(args ...string) error) func() {
+	previous := goreleaser
+	goreleaser = run
+
+	return func() {
+		goreleaser = previous
+	}
+}
@@ -0,0 +1,54 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aserto-dev/mage-loot/fsutil"
+	"github.com/pkg/errors"
+)
+
+// gitleaksHookMarker identifies the pre-commit hooks installed by InstallGitleaksHook, which can be replaced.
+const gitleaksHookMarker = "# Installed by mage-loot to scan staged changes for leaks."
+
+// InstallGitleaksHook installs a git pre-commit hook that runs command, which should call
+// GitleaksCheckStaged, like 'mage leaksStaged'. A pre-commit hook that wasn't installed
+// by InstallGitleaksHook isn't replaced.
+func InstallGitleaksHook(command string) error {
+	if strings.TrimSpace(command) == "" {
+		return errors.New("please provide the command the pre-commit hook runs, like 'mage leaksStaged'")
+	}
+
+	hookPath, err := gitOutput("rev-parse", "--git-path", "hooks/pre-commit")
+	if err != nil {
+		return errors.Wrap(err, "please make sure this is a git repo - failed to find the hooks directory")
+	}
+	hookPath = strings.TrimSpace(hookPath)
+	if !filepath.IsAbs(hookPath) {
+		hookPath = filepath.Join(WorkDir(), hookPath)
+	}
+
+	if exists, _ := fsutil.FileExists(hookPath); exists {
+		existing, err := os.ReadFile(hookPath)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read '%s'", hookPath)
+		}
+		if !strings.Contains(string(existing), gitleaksHookMarker) {
+			return errors.Errorf("'%s' already exists, please add '%s' to it", hookPath, command)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(hookPath), 0755); err != nil {
+		return errors.Wrapf(err, "failed to create '%s'", filepath.Dir(hookPath))
+	}
+
+	hook := "#!/bin/sh\n" + gitleaksHookMarker + "\nexec " + command + "\n"
+	if err := os.WriteFile(hookPath, []byte(hook), 0755); err != nil { //nolint:gosec // hooks must be executable
+		return errors.Wrapf(err, "failed to write '%s'", hookPath)
+	}
+
+	UI.Normal().WithStringValue("path", hookPath).WithStringValue("command", command).Msg("Installed pre-commit hook.")
+
+	return nil
+}
@@ -0,0 +1,33 @@
+package common_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/mage-loot/common"
+)
+
+func TestInstallGitleaksHook(t *testing.T) {
+	assert := require.New(t)
+	dir := gitRepo(t)
+	hookPath := filepath.Join(dir, ".git", "hooks", "pre-commit")
+
+	assert.ErrorContains(common.InstallGitleaksHook(""), "please provide the command")
+
+	assert.NoError(common.InstallGitleaksHook("mage leaksStaged"))
+	assert.NoError(common.InstallGitleaksHook("mage leaks:staged"))
+
+	hook, err := os.ReadFile(hookPath)
+	assert.NoError(err)
+	assert.Contains(string(hook), "\nexec mage leaks:staged\n")
+
+	info, err := os.Stat(hookPath)
+	assert.NoError(err)
+	assert.NotZero(info.Mode() & 0100)
+
+	assert.NoError(os.WriteFile(hookPath, []byte("#!/bin/sh\nmake lint\n"), 0600))
+	assert.ErrorContains(common.InstallGitleaksHook("mage leaksStaged"), "already exists")
+}
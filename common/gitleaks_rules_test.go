@@ -0,0 +1,99 @@
+package common_test
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/mage-loot/common"
+)
+
+// fixtureJoin splits the samples in testdata/gitleaks where a secret's prefix ends, like 'sk_ + live_...'.
+// Fixtures are assembled at runtime, so that scanning this repo doesn't find them.
+const fixtureJoin = " + "
+
+// The fixtures in testdata/gitleaks have a positive and a negative file per built-in rule, with a sample per line.
+// Every positive sample must be found by its rule, and negative samples must not be found by any rule.
+func TestGitleaksRuleFixtures(t *testing.T) {
+	ruleIDs, err := common.BuiltinGitleaksRuleIDs()
+	require.NoError(t, err)
+	require.NotEmpty(t, ruleIDs)
+
+	for _, ruleID := range ruleIDs {
+		t.Run(ruleID, func(t *testing.T) {
+			positive := filepath.Join("testdata", "gitleaks", "positive", ruleID+".txt")
+			for _, sample := range fixtureSamples(t, positive) {
+				findings, err := common.DetectBuiltinLeaks(sample)
+				require.NoError(t, err)
+
+				rules := []string{}
+				for _, f := range findings {
+					rules = append(rules, f.RuleID)
+				}
+				require.Contains(t, rules, ruleID, "sample %q", sample)
+			}
+
+			negative := filepath.Join("testdata", "gitleaks", "negative", ruleID+".txt")
+			for _, sample := range fixtureSamples(t, negative) {
+				findings, err := common.DetectBuiltinLeaks(sample)
+				require.NoError(t, err)
+				require.Empty(t, findings, "sample %q", sample)
+			}
+		})
+	}
+}
+
+// TestGitleaksFixturesAreSplit checks that the fixtures as stored aren't found, and that there are none for unknown rules.
+func TestGitleaksFixturesAreSplit(t *testing.T) {
+	ruleIDs, err := common.BuiltinGitleaksRuleIDs()
+	require.NoError(t, err)
+
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "gitleaks", "*", "*.txt"))
+	require.NoError(t, err)
+
+	ids := map[string]bool{}
+	for _, fixture := range fixtures {
+		ruleID := strings.TrimSuffix(filepath.Base(fixture), ".txt")
+		ids[ruleID] = true
+		require.Contains(t, ruleIDs, ruleID, "fixture %s has no rule", fixture)
+
+		content, err := os.ReadFile(fixture)
+		require.NoError(t, err)
+
+		findings, err := common.DetectBuiltinLeaks(string(content))
+		require.NoError(t, err)
+		for _, f := range findings {
+			t.Errorf("%s:%d is found by %s, please split the secret using %q", fixture, f.StartLine+1, f.RuleID, fixtureJoin)
+		}
+	}
+
+	missing := []string{}
+	for _, ruleID := range ruleIDs {
+		if !ids[ruleID] {
+			missing = append(missing, ruleID)
+		}
+	}
+	sort.Strings(missing)
+	require.Empty(t, missing, "rules without fixtures")
+}
+
+func fixtureSamples(t *testing.T, path string) []string {
+	t.Helper()
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err, "please add samples for the rule")
+
+	samples := []string{}
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.TrimSpace(line) != "" {
+			samples = append(samples, strings.ReplaceAll(line, fixtureJoin, ""))
+		}
+	}
+	require.NotEmpty(t, samples, "no samples in %s", path)
+
+	return samples
+}
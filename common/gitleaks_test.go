@@ -0,0 +1,225 @@
+package common_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/require"
+	"github.com/zricethezav/gitleaks/v8/report"
+
+	"github.com/aserto-dev/mage-loot/common"
+)
+
+// Fixtures are assembled at runtime, so that scanning this repo doesn't find them.
+var (
+	awsKey        = "AKIA" + "QWERTYUIOPASDFGH"
+	internalToken = "itk_" + strings.Repeat("a1b2", 6)
+)
+
+func TestGitleaksRepoConfig(t *testing.T) {
+	assert := require.New(t)
+	dir := gitRepo(t)
+
+	writeFile(t, dir, "config.txt", "aws = "+awsKey+"\n")
+	writeFile(t, dir, "allowed.txt", "aws = "+awsKey+" # gitleaks:allow\n")
+	writeFile(t, dir, "fixtures/keys.txt", "aws = "+awsKey+"\n")
+	writeFile(t, dir, "token.txt", "token: "+internalToken+"\n")
+	git(t, dir, "add", "-N", ".")
+
+	findings, err := common.GitleaksFindings()
+	assert.NoError(err)
+	assert.Equal([]string{"aws-access-token config.txt", "aws-access-token fixtures/keys.txt"}, findingKeys(findings))
+
+	writeFile(t, dir, common.GitleaksConfigFile, `
+[[rules]]
+id = "internal-token"
+description = "Internal token"
+regex = '''itk_[a-z0-9]{24}'''
+
+[allowlist]
+paths = ['''^fixtures/''']
+`)
+
+	findings, err = common.GitleaksFindings()
+	assert.NoError(err)
+	assert.Equal([]string{"aws-access-token config.txt", "internal-token token.txt"}, findingKeys(findings))
+
+	writeFile(t, dir, common.GitleaksConfigFile, "[allowlist]\nregexes = ['''[''']\n")
+	_, err = common.GitleaksFindings()
+	assert.ErrorContains(err, "invalid regex in gitleaks allowlist")
+}
+
+func TestGitleaksBaseline(t *testing.T) {
+	assert := require.New(t)
+	dir := gitRepo(t)
+
+	writeFile(t, dir, "config.txt", "aws = "+awsKey+"\n")
+	git(t, dir, "add", "-N", ".")
+
+	assert.NoError(common.GitleaksBaseline())
+
+	baseline, err := os.ReadFile(filepath.Join(dir, common.GitleaksBaselineFile))
+	assert.NoError(err)
+	assert.Contains(string(baseline), `"RuleID": "aws-access-token"`)
+	assert.NotContains(string(baseline), awsKey)
+
+	findings, err := common.GitleaksFindings()
+	assert.NoError(err)
+	assert.Empty(findings)
+
+	writeFile(t, dir, "other.txt", "aws = "+awsKey+"\n")
+	git(t, dir, "add", "-N", "other.txt")
+
+	findings, err = common.GitleaksFindings()
+	assert.NoError(err)
+	assert.Equal([]string{"aws-access-token other.txt"}, findingKeys(findings))
+
+	// Staged changes are accepted using the args of GitleaksScan.
+	git(t, dir, "add", ".")
+	assertLeaks(t, common.GitleaksCheckStaged(), "aws-access-token other.txt")
+	assert.NoError(common.GitleaksBaselineScan("--staged"))
+	assert.NoError(common.GitleaksCheckStaged())
+	assert.ErrorContains(common.GitleaksBaselineScan("--report-json=out.json"), "reports can't be written")
+
+	// A directory scan skips the baseline, even one that still contains the secrets.
+	writeFile(t, dir, common.GitleaksBaselineFile, `[{"Secret": "`+awsKey+`"}]`)
+	assert.NoError(common.GitleaksBaselineScan("--dir=."))
+	baseline, err = os.ReadFile(filepath.Join(dir, common.GitleaksBaselineFile))
+	assert.NoError(err)
+	assert.NotContains(string(baseline), awsKey)
+	assert.NotContains(string(baseline), `"File": "`+common.GitleaksBaselineFile+`"`)
+	assert.Contains(string(baseline), `"File": "config.txt"`)
+	assert.Contains(string(baseline), `"File": "other.txt"`)
+	assert.NoError(common.GitleaksScan("--dir=."))
+}
+
+func findingKeys(findings []report.Finding) []string {
+	keys := []string{}
+	for _, f := range findings {
+		keys = append(keys, f.RuleID+" "+f.File)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func TestGitleaksCheckReports(t *testing.T) {
+	assert := require.New(t)
+	dir := gitRepo(t)
+
+	assert.NoError(common.GitleaksCheck())
+
+	writeFile(t, dir, "config.txt", "first line\naws = "+awsKey+"\n")
+	git(t, dir, "add", "-N", ".")
+
+	err := common.GitleaksScan("--report-sarif=reports/gitleaks.sarif", "--report-json="+filepath.Join(dir, "gitleaks.json"))
+
+	var leaksErr *common.LeaksFoundError
+	assert.True(errors.As(err, &leaksErr))
+	assert.Len(leaksErr.Leaks, 1)
+	leak := leaksErr.Leaks[0]
+	assert.Equal(common.Leak{File: "config.txt", Line: 2, RuleID: "aws-access-token", Secret: leak.Secret}, leak)
+	assert.True(strings.HasSuffix(leak.Secret, "..."))
+	assert.EqualError(err, "leaks found: 1")
+
+	sarif, err := os.ReadFile(filepath.Join(dir, "reports/gitleaks.sarif"))
+	assert.NoError(err)
+	assert.Contains(string(sarif), `"ruleId": "aws-access-token"`)
+	assert.NotContains(string(sarif), awsKey)
+
+	var findings []report.Finding
+	content, err := os.ReadFile(filepath.Join(dir, "gitleaks.json"))
+	assert.NoError(err)
+	assert.NoError(json.Unmarshal(content, &findings))
+	assert.Len(findings, 1)
+	assert.Equal(leak.Secret, findings[0].Secret)
+
+	assert.ErrorContains(common.GitleaksScan("--report-xml=out.xml"), "unknown gitleaks argument")
+}
+
+func TestGitleaksScanModes(t *testing.T) {
+	assert := require.New(t)
+	dir := gitRepo(t)
+	first := strings.TrimSpace(git(t, dir, "rev-parse", "HEAD"))
+
+	writeFile(t, dir, "config.txt", "aws = "+awsKey+"\n")
+	git(t, dir, "add", "config.txt")
+
+	assert.NoError(common.GitleaksCheck())
+	assertLeaks(t, common.GitleaksCheckStaged(), "aws-access-token config.txt")
+
+	git(t, dir, "commit", "-qm", "add config")
+	commit := strings.TrimSpace(git(t, dir, "rev-parse", "HEAD"))
+
+	assert.NoError(common.GitleaksCheckStaged())
+	assert.NoError(common.GitleaksScan("--range=" + commit + "..HEAD"))
+	assertLeaks(t, common.GitleaksScan("--range="+first+"..HEAD"), "aws-access-token config.txt")
+	assertLeaks(t, common.GitleaksCheckHistory(), "aws-access-token config.txt")
+
+	var leaksErr *common.LeaksFoundError
+	assert.True(errors.As(common.GitleaksScan("--history"), &leaksErr))
+	assert.Equal(commit, leaksErr.Leaks[0].Commit)
+
+	assert.ErrorContains(common.GitleaksScan("--staged", "--history"), "only one of")
+	assert.ErrorContains(common.GitleaksScan("--range"), "needs a range")
+}
+
+func TestGitleaksScanDir(t *testing.T) {
+	assert := require.New(t)
+
+	dir := t.TempDir()
+	defer common.SetWorkDir(dir)()
+
+	writeFile(t, dir, "dist/app.env", "AWS_ACCESS_KEY_ID="+awsKey+"\n")
+	writeFile(t, dir, "dist/readme.txt", "nothing to see\n")
+	writeFile(t, dir, "other/app.env", "AWS_ACCESS_KEY_ID="+awsKey+"\n")
+
+	// Without a repo, only directories are scanned.
+	assert.NoError(common.GitleaksCheck())
+	assertLeaks(t, common.GitleaksScan("--dir=dist"), "aws-access-token dist/app.env")
+	assert.ErrorContains(common.GitleaksScan("--dir=missing"), "doesn't exist")
+}
+
+func TestGitleaksScanDirLogging(t *testing.T) {
+	assert := require.New(t)
+
+	dir := t.TempDir()
+	defer common.SetWorkDir(dir)()
+	writeFile(t, dir, "dist/readme.txt", "nothing to see\n")
+
+	var logs bytes.Buffer
+	logger, level := log.Logger, zerolog.GlobalLevel()
+	defer func() {
+		log.Logger = logger
+		zerolog.SetGlobalLevel(level)
+	}()
+	log.Logger = zerolog.New(&logs)
+	zerolog.SetGlobalLevel(zerolog.TraceLevel)
+
+	// gitleaks traces every file it scans.
+	assert.NoError(common.GitleaksScan("--dir=dist"))
+	assert.Empty(logs.String())
+	assert.Equal(zerolog.TraceLevel, zerolog.GlobalLevel())
+}
+
+func assertLeaks(t *testing.T, err error, expected ...string) {
+	t.Helper()
+
+	var leaksErr *common.LeaksFoundError
+	require.True(t, errors.As(err, &leaksErr), "expected leaks, got %v", err)
+
+	keys := []string{}
+	for _, l := range leaksErr.Leaks {
+		keys = append(keys, l.RuleID+" "+l.File)
+	}
+	sort.Strings(keys)
+	require.Equal(t, expected, keys)
+}
@@ -0,0 +1,474 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/aserto-dev/mage-loot/deps"
+	"github.com/aserto-dev/mage-loot/fsutil"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// GoreleaserConfigFile is the goreleaser config written by GenerateGoreleaserConfig.
+const GoreleaserConfigFile = ".goreleaser.yaml"
+
+var (
+	// goreleaserConfigFiles are the configs goreleaser looks for, in order, if it isn't given one.
+	goreleaserConfigFiles = []string{
+		".config/goreleaser.yml", ".config/goreleaser.yaml",
+		".goreleaser.yml", ".goreleaser.yaml",
+		"goreleaser.yml", "goreleaser.yaml",
+	}
+
+	// goreleaser runs the goreleaser dependency. It's replaced in tests.
+	goreleaser = func(args ...string) error {
+		return deps.GoDep("goreleaser")(args...)
+	}
+)
+
+type goreleaserConfig struct {
+	Version     int                 `yaml:"version"`
+	ProjectName string              `yaml:"project_name"`
+	Builds      []goreleaserBuild   `yaml:"builds"`
+	Archives    []goreleaserArchive `yaml:"archives"`
+	Checksum    goreleaserChecksum  `yaml:"checksum"`
+}
+
+type goreleaserBuild struct {
+	ID           string             `yaml:"id"`
+	Dir          string             `yaml:"dir,omitempty"`
+	Main         string             `yaml:"main"`
+	Binary       string             `yaml:"binary"`
+	Env          []string           `yaml:"env,omitempty"`
+	Flags        []string           `yaml:"flags,omitempty"`
+	Tags         []string           `yaml:"tags,omitempty"`
+	Ldflags      []string           `yaml:"ldflags,omitempty"`
+	ModTimestamp string             `yaml:"mod_timestamp,omitempty"`
+	Goos         []string           `yaml:"goos"`
+	Goarch       []string           `yaml:"goarch"`
+	Goarm        []string           `yaml:"goarm,omitempty"`
+	Ignore       []goreleaserTarget `yaml:"ignore,omitempty"`
+}
+
+type goreleaserTarget struct {
+	Goos   string `yaml:"goos"`
+	Goarch string `yaml:"goarch"`
+	Goarm  string `yaml:"goarm,omitempty"`
+}
+
+type goreleaserArchive struct {
+	NameTemplate    string                     `yaml:"name_template"`
+	FormatOverrides []goreleaserFormatOverride `yaml:"format_overrides"`
+	Files           []string                   `yaml:"files"`
+}
+
+type goreleaserFormatOverride struct {
+	Goos    string   `yaml:"goos"`
+	Formats []string `yaml:"formats"`
+}
+
+type goreleaserChecksum struct {
+	NameTemplate string `yaml:"name_template"`
+}
+
+// GenerateGoreleaserConfig writes a baseline .goreleaser.yaml with a build per command and the targets
+// of the build matrix, and archives named like the ones created by Package.
+// An existing config, like '.goreleaser.yml', is only overwritten if the args include '--force'.
+func GenerateGoreleaserConfig(args ...string) error {
+	force := false
+	for _, arg := range args {
+		if arg != "--force" {
+			return errors.Errorf("unknown argument '%s'", arg)
+		}
+		force = true
+	}
+
+	existing, err := goreleaserConfigPath(nil)
+	if err != nil {
+		return err
+	}
+	if existing != "" && !force {
+		return errors.Errorf("'%s' already exists, use '--force' to overwrite it", existing)
+	}
+
+	// The existing config is the one goreleaser reads, so it's overwritten instead of adding another one.
+	configPath := existing
+	if configPath == "" {
+		configPath = filepath.Join(cwd, GoreleaserConfigFile)
+	}
+
+	cfg, err := baselineGoreleaserConfig()
+	if err != nil {
+		return err
+	}
+
+	content, err := yaml.Marshal(cfg)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal goreleaser config")
+	}
+
+	if err := os.WriteFile(configPath, content, 0644); err != nil { //nolint:gosec // the config is committed
+		return errors.Wrapf(err, "failed to write '%s'", configPath)
+	}
+
+	UI.Normal().WithStringValue("path", configPath).WithIntValue("builds", int64(len(cfg.Builds))).Msg("Generated goreleaser config.")
+
+	return nil
+}
+
+// GoreleaserCheck validates the goreleaser config using 'goreleaser check'.
+// The config is found like goreleaser does, e.g. '.goreleaser.yml' or '.goreleaser.yaml'.
+// Without a config, goreleaser uses its defaults and there's nothing to check.
+func GoreleaserCheck() error {
+	return goreleaserCheck(nil)
+}
+
+// goreleaserCheck validates the config passed in args using '--config' or '-f', or the one goreleaser finds.
+func goreleaserCheck(args []string) error {
+	configPath, err := goreleaserConfigPath(args)
+	if err != nil {
+		return err
+	}
+	if configPath == "" {
+		UI.Note().Msg("No goreleaser config found, skipping check.")
+		return nil
+	}
+
+	return goreleaser("check", "--config", configPath)
+}
+
+// goreleaserConfigPath returns the config passed in args using '--config' or '-f',
+// or else the first of goreleaserConfigFiles that exists. It's empty if there's none.
+func goreleaserConfigPath(args []string) (string, error) {
+	for i, arg := range args {
+		for _, flag := range []string{"--config", "-f"} {
+			value, ok := strings.CutPrefix(arg, flag+"=")
+			if arg == flag {
+				if i+1 == len(args) {
+					return "", errors.Errorf("'%s' needs a value", flag)
+				}
+				value, ok = args[i+1], true
+			}
+			if !ok {
+				continue
+			}
+
+			if !filepath.IsAbs(value) {
+				value = filepath.Join(cwd, value)
+			}
+			return value, nil
+		}
+	}
+
+	for _, f := range goreleaserConfigFiles {
+		configPath := filepath.Join(cwd, filepath.FromSlash(f))
+		if exists, _ := fsutil.FileExists(configPath); exists {
+			return configPath, nil
+		}
+	}
+
+	return "", nil
+}
+
+// GoreleaserDrift compares .goreleaser.yaml with the baseline generated from the commands and the build
+// matrix, and prints the settings that differ or are missing. Settings that are only in .goreleaser.yaml,
+// like dockers or brews, are customizations and aren't reported.
+func GoreleaserDrift() ([]string, error) {
+	configPath, err := goreleaserConfigPath(nil)
+	if err != nil {
+		return nil, err
+	}
+	if configPath == "" {
+		return nil, errors.New("no goreleaser config found, please generate one using GenerateGoreleaserConfig")
+	}
+
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read '%s'", configPath)
+	}
+
+	var current interface{}
+	if err := yaml.Unmarshal(content, &current); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse '%s'", configPath)
+	}
+
+	cfg, err := baselineGoreleaserConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// The baseline goes through yaml so that both sides have the same types.
+	baselineContent, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal goreleaser config")
+	}
+	var baseline interface{}
+	if err := yaml.Unmarshal(baselineContent, &baseline); err != nil {
+		return nil, errors.Wrap(err, "failed to parse goreleaser config")
+	}
+
+	drift := yamlDrift("", baseline, current)
+	for _, d := range drift {
+		UI.Exclamation().Msgf("goreleaser config drift: %s", d)
+	}
+	if len(drift) == 0 {
+		UI.Normal().Msg("Goreleaser config matches the baseline.")
+	}
+
+	return drift, nil
+}
+
+// baselineGoreleaserConfig creates the config for the commands and targets in the build matrix.
+func baselineGoreleaserConfig() (*goreleaserConfig, error) {
+	matrix, err := resolveBuildMatrix()
+	if err != nil {
+		return nil, err
+	}
+
+	cmds, err := commands(matrix)
+	if err != nil {
+		return nil, err
+	}
+
+	reproducible := matrix.Reproducible == nil || *matrix.Reproducible
+	date := "{{ .Date }}"
+	if reproducible {
+		date = "{{ .CommitDate }}"
+	}
+	flags := matrix.buildFlags("{{ .Version }}", "{{ .ShortCommit }}", date, nil)
+
+	cfg := &goreleaserConfig{
+		Version:     2,
+		ProjectName: filepath.Base(cwd),
+		Archives: []goreleaserArchive{{
+			NameTemplate:    "{{ .ProjectName }}_{{ .Version }}_{{ .Os }}_{{ .Arch }}{{ with .Arm }}v{{ . }}{{ end }}",
+			FormatOverrides: []goreleaserFormatOverride{{Goos: osWindows, Formats: []string{"zip"}}},
+			Files:           PackageFiles,
+		}},
+		Checksum: goreleaserChecksum{NameTemplate: ChecksumsFile},
+	}
+
+	for _, c := range cmds {
+		main, err := packageDir(c)
+		if err != nil {
+			return nil, err
+		}
+
+		b := goreleaserBuild{
+			ID:     c.Name,
+			Main:   main,
+			Binary: c.Name,
+			Tags:   c.Tags,
+		}
+		if dir, err := filepath.Rel(cwd, c.Dir); err == nil && dir != "." {
+			b.Dir = filepath.ToSlash(dir)
+		}
+		if c.CGO != nil {
+			b.Env = []string{"CGO_ENABLED=0"}
+			if *c.CGO {
+				b.Env = []string{"CGO_ENABLED=1"}
+			}
+		}
+		for _, f := range flags {
+			if ldflags, ok := strings.CutPrefix(f, "-ldflags="); ok {
+				b.Ldflags = append(b.Ldflags, ldflags)
+			} else {
+				b.Flags = append(b.Flags, f)
+			}
+		}
+		if reproducible {
+			b.ModTimestamp = "{{ .CommitTimestamp }}"
+		}
+
+		setGoreleaserTargets(&b, matrix.TargetsFor(c.Name))
+		cfg.Builds = append(cfg.Builds, b)
+	}
+
+	return cfg, nil
+}
+
+// packageDir returns the directory of a command's package, relative to its module, like './cmd/app'.
+func packageDir(c Command) (string, error) {
+	out, err := goOutput(nil, c.Dir, "list", "-f", "{{.Dir}}", c.Package)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(c.Dir, strings.TrimSpace(out))
+	if err != nil {
+		return "", errors.Wrapf(err, "package '%s' isn't in '%s'", c.Package, c.Dir)
+	}
+
+	if rel == "." {
+		return ".", nil
+	}
+
+	return "./" + filepath.ToSlash(rel), nil
+}
+
+// setGoreleaserTargets sets the lists goreleaser builds all combinations of, and ignores the
+// combinations that aren't targets.
+func setGoreleaserTargets(b *goreleaserBuild, targets []Target) {
+	goos, goarch, goarm := map[string]bool{}, map[string]bool{}, map[string]bool{}
+	wanted := map[Target]bool{}
+	for _, t := range targets {
+		goos[t.OS], goarch[t.Arch] = true, true
+		if t.ARM != "" {
+			goarm[t.ARM] = true
+		}
+		wanted[t] = true
+	}
+
+	b.Goos, b.Goarch, b.Goarm = sortedKeys(goos), sortedKeys(goarch), sortedKeys(goarm)
+
+	for _, o := range b.Goos {
+		for _, a := range b.Goarch {
+			variants := []string{""}
+			if a == "arm" && len(b.Goarm) != 0 {
+				variants = b.Goarm
+			}
+			for _, v := range variants {
+				if !wanted[Target{OS: o, Arch: a, ARM: v}] {
+					b.Ignore = append(b.Ignore, goreleaserTarget{Goos: o, Goarch: a, Goarm: v})
+				}
+			}
+		}
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// yamlDrift lists the values in baseline that are missing or different in current.
+// Lists of maps with an 'id', like builds, are matched by id instead of position.
+func yamlDrift(path string, baseline, current interface{}) []string {
+	drift := []string{}
+
+	switch b := baseline.(type) {
+	case map[interface{}]interface{}:
+		c, ok := current.(map[interface{}]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected a map", pathOrRoot(path))}
+		}
+
+		keys := []string{}
+		for k := range b {
+			keys = append(keys, fmt.Sprint(k))
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			value, ok := c[k]
+			if !ok {
+				drift = append(drift, fmt.Sprintf("%s: missing, expected %s", joinPath(path, k), yamlInline(b[k])))
+				continue
+			}
+			drift = append(drift, yamlDrift(joinPath(path, k), b[k], value)...)
+		}
+	case []interface{}:
+		c, ok := current.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected a list", pathOrRoot(path))}
+		}
+
+		if ids := itemIDs(c); ids != nil && itemIDs(b) != nil {
+			for _, item := range b {
+				id := fmt.Sprint(item.(map[interface{}]interface{})["id"])
+				value, ok := ids[id]
+				if !ok {
+					drift = append(drift, fmt.Sprintf("%s[%s]: missing", pathOrRoot(path), id))
+					continue
+				}
+				drift = append(drift, yamlDrift(fmt.Sprintf("%s[%s]", path, id), item, value)...)
+			}
+			return drift
+		}
+
+		if isScalarList(b) {
+			if !reflect.DeepEqual(b, c) {
+				drift = append(drift, fmt.Sprintf("%s: expected %s, found %s", pathOrRoot(path), yamlInline(b), yamlInline(c)))
+			}
+			return drift
+		}
+		if len(b) != len(c) {
+			return []string{fmt.Sprintf("%s: expected %d items, found %d", pathOrRoot(path), len(b), len(c))}
+		}
+		for i := range b {
+			drift = append(drift, yamlDrift(fmt.Sprintf("%s[%d]", path, i), b[i], c[i])...)
+		}
+	default:
+		if fmt.Sprint(baseline) != fmt.Sprint(current) {
+			drift = append(drift, fmt.Sprintf("%s: expected %s, found %s", pathOrRoot(path), yamlInline(baseline), yamlInline(current)))
+		}
+	}
+
+	return drift
+}
+
+// itemIDs maps the 'id' of every item to the item, or returns nil if not all items are maps with an id.
+func itemIDs(items []interface{}) map[string]interface{} {
+	ids := map[string]interface{}{}
+	for _, item := range items {
+		m, ok := item.(map[interface{}]interface{})
+		if !ok || m["id"] == nil {
+			return nil
+		}
+		ids[fmt.Sprint(m["id"])] = item
+	}
+
+	return ids
+}
+
+func isScalarList(items []interface{}) bool {
+	for _, item := range items {
+		switch item.(type) {
+		case map[interface{}]interface{}, []interface{}:
+			return false
+		}
+	}
+
+	return true
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "."
+	}
+
+	return path
+}
+
+// yamlInline renders a value on a single line, with lists in flow style.
+func yamlInline(value interface{}) string {
+	list, ok := value.([]interface{})
+	if !ok {
+		return fmt.Sprint(value)
+	}
+
+	items := make([]string, 0, len(list))
+	for _, item := range list {
+		items = append(items, yamlInline(item))
+	}
+
+	return "[" + strings.Join(items, ", ") + "]"
+}
@@ -0,0 +1,151 @@
+package common_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+
+	"github.com/aserto-dev/mage-loot/common"
+)
+
+func TestGenerateGoreleaserConfig(t *testing.T) {
+	assert := require.New(t)
+
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module example.com/app\n\ngo 1.22\n")
+	writeFile(t, dir, "cmd/server/main.go", "package main\n\nfunc main() {}\n")
+	writeFile(t, dir, "cmd/agent/main.go", "package main\n\nfunc main() {}\n")
+	writeFile(t, dir, common.BuildMatrixFile, `
+targets: ["linux/amd64", "linux/arm64", "darwin/arm64", "windows/amd64"]
+commands:
+  agent:
+    exclude: ["windows/amd64"]
+versionVars:
+  version: example.com/app/pkg/version.ver
+`)
+	defer common.SetWorkDir(dir)()
+
+	assert.NoError(common.GenerateGoreleaserConfig())
+	assert.ErrorContains(common.GenerateGoreleaserConfig(), "already exists")
+
+	content, err := os.ReadFile(filepath.Join(dir, common.GoreleaserConfigFile))
+	assert.NoError(err)
+
+	var cfg struct {
+		Builds []struct {
+			ID      string
+			Main    string
+			Flags   []string
+			Ldflags []string
+			Goos    []string
+			Goarch  []string
+			Ignore  []map[string]string
+		}
+	}
+	assert.NoError(yaml.Unmarshal(content, &cfg))
+	assert.Len(cfg.Builds, 2)
+
+	agent, server := cfg.Builds[0], cfg.Builds[1]
+	assert.Equal("agent", agent.ID)
+	assert.Equal("./cmd/agent", agent.Main)
+	assert.Equal([]string{"-trimpath"}, agent.Flags)
+	assert.Equal([]string{"-buildid= -X example.com/app/pkg/version.ver={{ .Version }}"}, agent.Ldflags)
+	assert.Equal([]string{"darwin", "linux"}, agent.Goos)
+	assert.Equal([]string{"amd64", "arm64"}, agent.Goarch)
+	assert.Equal([]map[string]string{{"goos": "darwin", "goarch": "amd64"}}, agent.Ignore)
+
+	assert.Equal([]string{"darwin", "linux", "windows"}, server.Goos)
+	assert.Len(server.Ignore, 2)
+
+	drift, err := common.GoreleaserDrift()
+	assert.NoError(err)
+	assert.Empty(drift)
+
+	// Customizations aren't drift, changes to generated settings are.
+	edited := strings.Replace(string(content), "- -trimpath", "- -race", 1) + "dockers:\n  - image_templates: [\"app:latest\"]\n"
+	edited = strings.Replace(edited, "name_template: checksums.txt", "name_template: sums.txt", 1)
+	assert.NoError(os.WriteFile(filepath.Join(dir, common.GoreleaserConfigFile), []byte(edited), 0600))
+
+	drift, err = common.GoreleaserDrift()
+	assert.NoError(err)
+	assert.Equal([]string{
+		"builds[agent].flags: expected [-trimpath], found [-race]",
+		"checksum.name_template: expected checksums.txt, found sums.txt",
+	}, drift)
+
+	assert.NoError(common.GenerateGoreleaserConfig("--force"))
+	drift, err = common.GoreleaserDrift()
+	assert.NoError(err)
+	assert.Empty(drift)
+}
+
+func TestGenerateGoreleaserConfigOverwritesExisting(t *testing.T) {
+	assert := require.New(t)
+
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module example.com/app\n\ngo 1.22\n")
+	writeFile(t, dir, "cmd/server/main.go", "package main\n\nfunc main() {}\n")
+	writeFile(t, dir, ".goreleaser.yml", "builds:\n  - id: old\n")
+	defer common.SetWorkDir(dir)()
+
+	assert.ErrorContains(common.GenerateGoreleaserConfig(), "'"+filepath.Join(dir, ".goreleaser.yml")+"' already exists")
+	assert.NoError(common.GenerateGoreleaserConfig("--force"))
+
+	// goreleaser reads .goreleaser.yml before .goreleaser.yaml, so that's the one that's overwritten.
+	assert.NoFileExists(filepath.Join(dir, common.GoreleaserConfigFile))
+	content, err := os.ReadFile(filepath.Join(dir, ".goreleaser.yml"))
+	assert.NoError(err)
+	assert.Contains(string(content), "id: server")
+
+	drift, err := common.GoreleaserDrift()
+	assert.NoError(err)
+	assert.Empty(drift)
+}
+
+func TestGoreleaserCheck(t *testing.T) {
+	assert := require.New(t)
+	dir := gitRepo(t)
+
+	calls := [][]string{}
+	checkErr := error(nil)
+	defer common.SetGoreleaser(func(args ...string) error {
+		calls = append(calls, args)
+		if args[0] == "check" {
+			return checkErr
+		}
+		return nil
+	})()
+
+	// Without a config, goreleaser uses its defaults.
+	assert.NoError(common.GoreleaserCheck())
+	assert.NoError(common.BuildAllReleaser())
+	assert.Equal([][]string{{"build", "--clean"}}, calls)
+
+	calls = nil
+	writeFile(t, dir, ".goreleaser.yml", "version: 2\n")
+	assert.NoError(common.GoreleaserCheck())
+	assert.ErrorContains(common.GenerateGoreleaserConfig(), ".goreleaser.yml' already exists")
+	assert.Equal([][]string{{"check", "--config", filepath.Join(dir, ".goreleaser.yml")}}, calls)
+
+	calls = nil
+	shared := filepath.Join(t.TempDir(), "goreleaser.yaml")
+	assert.NoError(common.BuildReleaser("--config", "release/goreleaser.yaml"))
+	assert.NoError(common.Release("-f="+shared, "--clean"))
+	assert.Equal([][]string{
+		{"check", "--config", filepath.Join(dir, "release", "goreleaser.yaml")},
+		{"build", "--clean", "--snapshot", "--single-target", "--config", "release/goreleaser.yaml"},
+		{"check", "--config", shared},
+		{"release", "-f=" + shared, "--clean"},
+	}, calls)
+
+	calls = nil
+	checkErr = errors.New("invalid config")
+	assert.ErrorContains(common.Release(), "invalid config")
+	assert.ErrorContains(common.BuildReleaser("--config"), "'--config' needs a value")
+	assert.Equal([][]string{{"check", "--config", filepath.Join(dir, ".goreleaser.yml")}}, calls)
+}
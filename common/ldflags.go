@@ -0,0 +1,92 @@
+package common
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VersionVars are fully qualified package variables, like 'github.com/org/repo/pkg/version.ver',
+// that are set using '-ldflags -X' when building. Empty ones are skipped.
+type VersionVars struct {
+	Version string `yaml:"version"`
+	Commit  string `yaml:"commit"`
+	Date    string `yaml:"date"`
+}
+
+// WithVersionVars injects the version, commit and build date into the given package variables.
+func WithVersionVars(version, commit, date string) BuildOption {
+	return func(m *BuildMatrix) {
+		m.VersionVars = VersionVars{Version: version, Commit: commit, Date: date}
+	}
+}
+
+// WithReproducible turns reproducible builds on or off.
+func WithReproducible(reproducible bool) BuildOption {
+	return func(m *BuildMatrix) {
+		m.Reproducible = &reproducible
+	}
+}
+
+// buildFlags returns the arguments for 'go build', with the version vars and reproducible flags
+// added to the given ones. Ldflags in args are kept, after the generated ones so they can override them.
+func (m *BuildMatrix) buildFlags(version, commit, date string, args []string) []string {
+	ldflags := []string{}
+	reproducible := m.Reproducible == nil || *m.Reproducible
+	if reproducible {
+		ldflags = append(ldflags, "-buildid=")
+	}
+
+	for _, v := range []struct{ name, value string }{
+		{m.VersionVars.Version, version},
+		{m.VersionVars.Commit, commit},
+		{m.VersionVars.Date, date},
+	} {
+		if v.name != "" {
+			ldflags = append(ldflags, "-X", v.name+"="+v.value)
+		}
+	}
+
+	flags := []string{}
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "-ldflags" || args[i] == "--ldflags":
+			if i+1 < len(args) {
+				ldflags = append(ldflags, args[i+1])
+				i++
+			}
+		case strings.HasPrefix(args[i], "-ldflags=") || strings.HasPrefix(args[i], "--ldflags="):
+			_, value, _ := strings.Cut(args[i], "=")
+			ldflags = append(ldflags, value)
+		case args[i] == "-trimpath" && reproducible:
+			// Added below.
+		default:
+			flags = append(flags, args[i])
+		}
+	}
+
+	if reproducible {
+		flags = append([]string{"-trimpath"}, flags...)
+	}
+	if len(ldflags) != 0 {
+		flags = append([]string{"-ldflags=" + strings.Join(ldflags, " ")}, flags...)
+	}
+
+	return flags
+}
+
+// buildDate returns the time of the build, which is taken from the
+// SOURCE_DATE_EPOCH env var for reproducible builds, if it's set.
+func buildDate() string {
+	return sourceDate().Format(time.RFC3339)
+}
+
+// sourceDate returns the time in SOURCE_DATE_EPOCH if it's set, or the current time.
+func sourceDate() time.Time {
+	if epoch, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		return time.Unix(epoch, 0).UTC()
+	}
+
+	return time.Now().UTC()
+}
@@ -0,0 +1,32 @@
+package common_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/mage-loot/common"
+)
+
+func TestBuildFlags(t *testing.T) {
+	assert := require.New(t)
+
+	m := &common.BuildMatrix{}
+	common.WithVersionVars("example.com/app/pkg/version.ver", "example.com/app/pkg/version.commit", "")(m)
+
+	flags := m.BuildFlags("1.2.3", "abc1234", "2024-01-02T03:04:05Z", []string{"-ldflags", "-s -w", "-tags=integration", "-trimpath"})
+	assert.Equal([]string{
+		"-ldflags=-buildid= -X example.com/app/pkg/version.ver=1.2.3 -X example.com/app/pkg/version.commit=abc1234 -s -w",
+		"-trimpath",
+		"-tags=integration",
+	}, flags)
+}
+
+func TestBuildFlagsNotReproducible(t *testing.T) {
+	assert := require.New(t)
+
+	m := &common.BuildMatrix{}
+	common.WithReproducible(false)(m)
+
+	assert.Equal([]string{"-race"}, m.BuildFlags("1.2.3", "abc1234", "", []string{"-race"}))
+}
@@ -0,0 +1,366 @@
+package common
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/aserto-dev/mage-loot/fsutil"
+	"github.com/magefile/mage/sh"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// BuildMatrixFile is the file the build matrix is loaded from, if it exists in the working directory.
+	BuildMatrixFile = "buildmatrix.yaml"
+
+	defaultOutput = "bin/{{.OS}}-{{.Arch}}{{if .ARM}}v{{.ARM}}{{end}}/{{.Name}}{{.Ext}}"
+	archARM       = "arm"
+)
+
+var (
+	ErrInvalidTarget = errors.New("invalid build target")
+
+	buildOptions = []BuildOption{}
+
+	// armVariants are the valid values of GOARM.
+	armVariants = map[string]bool{"5": true, "6": true, "7": true}
+)
+
+// Target is a platform to build binaries for, written as 'os/arch' or 'os/arm/variant' (like 'linux/arm/7').
+type Target struct {
+	OS   string
+	Arch string
+	// ARM is the GOARM variant, only used when Arch is 'arm'.
+	ARM string
+}
+
+// ParseTarget parses a target like 'linux/amd64' or 'linux/arm/7'.
+func ParseTarget(s string) (Target, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return Target{}, errors.Wrapf(ErrInvalidTarget, "'%s' isn't 'os/arch' or 'os/arm/variant'", s)
+	}
+
+	t := Target{OS: parts[0], Arch: parts[1]}
+	if len(parts) == 3 {
+		t.ARM = strings.TrimPrefix(parts[2], "v")
+	}
+
+	return t, nil
+}
+
+func (t Target) String() string {
+	if t.ARM != "" {
+		return t.OS + "/" + t.Arch + "/" + t.ARM
+	}
+
+	return t.OS + "/" + t.Arch
+}
+
+// UnmarshalYAML reads a target from a string like 'linux/arm/7'.
+func (t *Target) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	parsed, err := ParseTarget(s)
+	if err != nil {
+		return err
+	}
+
+	*t = parsed
+	return nil
+}
+
+// env returns the env vars for cross-compiling to the target.
+func (t Target) env() map[string]string {
+	env := map[string]string{
+		"GOOS":   t.OS,
+		"GOARCH": t.Arch,
+	}
+	if t.ARM != "" {
+		env["GOARM"] = t.ARM
+	}
+
+	return env
+}
+
+// CommandTargets changes the build matrix for a single command.
+type CommandTargets struct {
+	// Include are targets built only for this command, besides the matrix targets.
+	Include []Target `yaml:"include"`
+	// Exclude are matrix targets this command isn't built for.
+	Exclude []Target `yaml:"exclude"`
+}
+
+// BuildMatrix describes the targets BuildAll builds each command for.
+type BuildMatrix struct {
+	// Packages are the patterns main packages are discovered with in every module. It defaults to './...'.
+	Packages []string `yaml:"packages"`
+	// Binaries are the commands to build. If it's set, commands aren't discovered.
+	Binaries []Command `yaml:"binaries"`
+	// Targets every command is built for.
+	Targets []Target `yaml:"targets"`
+	// Commands changes the targets of individual commands, by name.
+	Commands map[string]CommandTargets `yaml:"commands"`
+	// Output is a template for the path of each binary, relative to the working directory.
+	// It can use {{.Name}}, {{.OS}}, {{.Arch}}, {{.ARM}} and {{.Ext}} (which is '.exe' on Windows).
+	Output string `yaml:"output"`
+	// Parallelism is the number of builds that run at the same time. It defaults to the number of CPUs.
+	Parallelism int `yaml:"parallelism"`
+	// VersionVars are the package variables the version, commit and date are injected into.
+	VersionVars VersionVars `yaml:"versionVars"`
+	// Reproducible builds with '-trimpath' and an empty build ID. It defaults to true.
+	Reproducible *bool `yaml:"reproducible"`
+}
+
+// BuildOption changes the build matrix.
+type BuildOption func(*BuildMatrix)
+
+// WithTargets replaces the targets every command is built for.
+func WithTargets(targets ...Target) BuildOption {
+	return func(m *BuildMatrix) {
+		m.Targets = targets
+	}
+}
+
+// WithInclude builds a command for additional targets.
+func WithInclude(cmd string, targets ...Target) BuildOption {
+	return func(m *BuildMatrix) {
+		c := m.Commands[cmd]
+		c.Include = append(c.Include, targets...)
+		m.Commands[cmd] = c
+	}
+}
+
+// WithExclude skips building a command for some of the matrix targets.
+func WithExclude(cmd string, targets ...Target) BuildOption {
+	return func(m *BuildMatrix) {
+		c := m.Commands[cmd]
+		c.Exclude = append(c.Exclude, targets...)
+		m.Commands[cmd] = c
+	}
+}
+
+// WithOutput sets the template for the path of each binary. See BuildMatrix.Output.
+func WithOutput(output string) BuildOption {
+	return func(m *BuildMatrix) {
+		m.Output = output
+	}
+}
+
+// WithParallelism sets the number of builds that run at the same time.
+func WithParallelism(n int) BuildOption {
+	return func(m *BuildMatrix) {
+		m.Parallelism = n
+	}
+}
+
+// ConfigureBuild sets options that are applied on top of the build matrix file, if there is one.
+func ConfigureBuild(options ...BuildOption) {
+	buildOptions = append(buildOptions, options...)
+}
+
+// DefaultBuildMatrix returns a matrix with all combinations of OSList and Architectures
+// that Go supports.
+func DefaultBuildMatrix() (*BuildMatrix, error) {
+	supported, err := supportedTargets()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &BuildMatrix{Commands: map[string]CommandTargets{}, Output: defaultOutput}
+	for _, o := range OSList {
+		for _, a := range Architectures {
+			if supported[o+"/"+a] {
+				m.Targets = append(m.Targets, Target{OS: o, Arch: a})
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// LoadBuildMatrix reads a build matrix file. Settings missing from the file
+// keep their default values.
+func LoadBuildMatrix(path string) (*BuildMatrix, error) {
+	m, err := DefaultBuildMatrix()
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	fromFile := &BuildMatrix{}
+	if err := yaml.UnmarshalStrict(content, fromFile); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal %s", path)
+	}
+
+	if len(fromFile.Targets) != 0 {
+		m.Targets = fromFile.Targets
+	}
+	if len(fromFile.Packages) != 0 {
+		m.Packages = fromFile.Packages
+	}
+	if len(fromFile.Binaries) != 0 {
+		m.Binaries = fromFile.Binaries
+	}
+	if fromFile.Output != "" {
+		m.Output = fromFile.Output
+	}
+	if fromFile.Parallelism != 0 {
+		m.Parallelism = fromFile.Parallelism
+	}
+	if fromFile.VersionVars != (VersionVars{}) {
+		m.VersionVars = fromFile.VersionVars
+	}
+	if fromFile.Reproducible != nil {
+		m.Reproducible = fromFile.Reproducible
+	}
+	for cmd, targets := range fromFile.Commands {
+		m.Commands[cmd] = targets
+	}
+
+	return m, nil
+}
+
+// resolveBuildMatrix returns the matrix from the build matrix file, or the default one,
+// with the options set using ConfigureBuild.
+func resolveBuildMatrix() (*BuildMatrix, error) {
+	var (
+		m   *BuildMatrix
+		err error
+	)
+
+	matrixPath := filepath.Join(cwd, BuildMatrixFile)
+	if exists, _ := fsutil.FileExists(matrixPath); exists {
+		m, err = LoadBuildMatrix(matrixPath)
+	} else {
+		m, err = DefaultBuildMatrix()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, o := range buildOptions {
+		o(m)
+	}
+
+	return m, m.Validate()
+}
+
+// Validate checks that all targets are supported by 'go tool dist list'.
+func (m *BuildMatrix) Validate() error {
+	supported, err := supportedTargets()
+	if err != nil {
+		return err
+	}
+
+	targets := append([]Target{}, m.Targets...)
+	for _, c := range m.Commands {
+		targets = append(targets, c.Include...)
+	}
+
+	invalid := []string{}
+	for _, t := range targets {
+		switch {
+		case !supported[t.OS+"/"+t.Arch]:
+			invalid = append(invalid, t.String())
+		case t.ARM != "" && (t.Arch != archARM || !armVariants[t.ARM]):
+			invalid = append(invalid, t.String())
+		}
+	}
+
+	if len(invalid) != 0 {
+		return errors.Wrapf(ErrInvalidTarget, "not supported by go: %s", strings.Join(invalid, ", "))
+	}
+
+	if _, err := template.New("output").Parse(m.Output); err != nil {
+		return errors.Wrap(err, "invalid output template")
+	}
+
+	return nil
+}
+
+// TargetsFor returns the targets a command is built for.
+func (m *BuildMatrix) TargetsFor(cmd string) []Target {
+	c := m.Commands[cmd]
+
+	targets := []Target{}
+	for _, t := range append(append([]Target{}, m.Targets...), c.Include...) {
+		if !containsTarget(c.Exclude, t) && !containsTarget(targets, t) {
+			targets = append(targets, t)
+		}
+	}
+
+	return targets
+}
+
+// OutputPath returns the absolute path of the binary of a command built for the target.
+func (m *BuildMatrix) OutputPath(cmd string, t Target) (string, error) {
+	output := m.Output
+	if output == "" {
+		output = defaultOutput
+	}
+
+	tpl, err := template.New("output").Parse(output)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid output template")
+	}
+
+	ext := ""
+	if t.OS == osWindows {
+		ext = windowsBinExtension
+	}
+
+	var buf bytes.Buffer
+	err = tpl.Execute(&buf, struct {
+		Name, OS, Arch, ARM, Ext string
+	}{cmd, t.OS, t.Arch, t.ARM, ext})
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to render output path for '%s'", cmd)
+	}
+
+	return filepath.Join(cwd, filepath.FromSlash(buf.String())), nil
+}
+
+func containsTarget(targets []Target, t Target) bool {
+	for _, other := range targets {
+		if other == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+var distList map[string]bool
+
+// supportedTargets returns the 'os/arch' pairs listed by 'go tool dist list'.
+func supportedTargets() (map[string]bool, error) {
+	if distList != nil {
+		return distList, nil
+	}
+
+	out, err := sh.Output("go", "tool", "dist", "list")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list platforms supported by go")
+	}
+
+	distList = map[string]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			distList[line] = true
+		}
+	}
+
+	return distList, nil
+}
@@ -0,0 +1,78 @@
+package common_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/mage-loot/common"
+)
+
+func TestDefaultBuildMatrix(t *testing.T) {
+	assert := require.New(t)
+
+	m, err := common.DefaultBuildMatrix()
+	assert.NoError(err)
+	assert.NoError(m.Validate())
+
+	targets := []string{}
+	for _, target := range m.Targets {
+		targets = append(targets, target.String())
+	}
+	assert.Contains(targets, "linux/arm64")
+	assert.Contains(targets, "darwin/arm64")
+	assert.NotContains(targets, "darwin/arm")
+}
+
+func TestLoadBuildMatrix(t *testing.T) {
+	assert := require.New(t)
+
+	matrixPath := filepath.Join(t.TempDir(), common.BuildMatrixFile)
+	assert.NoError(os.WriteFile(matrixPath, []byte(`
+targets:
+- linux/amd64
+- linux/arm/7
+- windows/amd64
+commands:
+  agent:
+    include: [linux/riscv64]
+    exclude: [windows/amd64]
+output: "dist/{{.Name}}_{{.OS}}_{{.Arch}}{{.ARM}}{{.Ext}}"
+`), 0600))
+
+	m, err := common.LoadBuildMatrix(matrixPath)
+	assert.NoError(err)
+	assert.NoError(m.Validate())
+
+	assert.Equal([]common.Target{
+		{OS: "linux", Arch: "amd64"},
+		{OS: "linux", Arch: "arm", ARM: "7"},
+		{OS: "linux", Arch: "riscv64"},
+	}, m.TargetsFor("agent"))
+	assert.Len(m.TargetsFor("cli"), 3)
+
+	out, err := m.OutputPath("cli", common.Target{OS: "windows", Arch: "amd64"})
+	assert.NoError(err)
+	assert.Equal(filepath.Join(common.WorkDir(), "dist", "cli_windows_amd64.exe"), out)
+
+	out, err = m.OutputPath("agent", common.Target{OS: "linux", Arch: "arm", ARM: "7"})
+	assert.NoError(err)
+	assert.Equal(filepath.Join(common.WorkDir(), "dist", "agent_linux_arm7"), out)
+}
+
+func TestInvalidTargets(t *testing.T) {
+	assert := require.New(t)
+
+	for _, target := range []string{"darwin/arm", "linux/amd64/7", "linux/arm/8", "plan10/amd64"} {
+		parsed, err := common.ParseTarget(target)
+		assert.NoError(err)
+
+		m := &common.BuildMatrix{Targets: []common.Target{parsed}}
+		assert.ErrorIs(m.Validate(), common.ErrInvalidTarget, target)
+	}
+
+	_, err := common.ParseTarget("linux")
+	assert.ErrorIs(err, common.ErrInvalidTarget)
+}
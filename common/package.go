@@ -0,0 +1,160 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aserto-dev/mage-loot/fsutil"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DistDir is the directory archives are written to by Package.
+	DistDir = "dist"
+	// ChecksumsFile lists the SHA256 of every archive created by Package.
+	ChecksumsFile = "checksums.txt"
+)
+
+// PackageFiles are glob patterns of the files added to every archive, besides the binaries.
+var PackageFiles = []string{"LICENSE*", "README*"}
+
+// Package creates an archive per build matrix target with the binaries built by BuildAll,
+// and PackageFiles. Archives are '.zip' files for windows and '.tar.gz' files otherwise,
+// named '<project>_<version>_<os>_<arch>', and are written to './dist' with a 'checksums.txt'.
+func Package() error {
+	version, err := Version()
+	if err != nil {
+		return err
+	}
+
+	matrix, err := resolveBuildMatrix()
+	if err != nil {
+		return err
+	}
+
+	cmds, err := commands(matrix)
+	if err != nil {
+		return err
+	}
+
+	extraFiles, err := packageFiles()
+	if err != nil {
+		return err
+	}
+
+	distDir := filepath.Join(cwd, DistDir)
+	if err := os.MkdirAll(distDir, 0755); err != nil {
+		return errors.Wrapf(err, "failed to create '%s'", distDir)
+	}
+
+	// Commands can have different targets, so the binaries are grouped by target.
+	binaries := map[Target][]fsutil.ArchiveFile{}
+	targets := []Target{}
+	for _, c := range cmds {
+		for _, t := range matrix.TargetsFor(c.Name) {
+			out, err := matrix.OutputPath(c.Name, t)
+			if err != nil {
+				return err
+			}
+			if exists, _ := fsutil.FileExists(out); !exists {
+				return errors.Errorf("binary '%s' doesn't exist, please build it first", out)
+			}
+
+			if _, ok := binaries[t]; !ok {
+				targets = append(targets, t)
+			}
+			binaries[t] = append(binaries[t], fsutil.ArchiveFile{Path: out, Name: filepath.Base(out)})
+		}
+	}
+
+	archives := []string{}
+	for _, t := range targets {
+		archive, err := packageTarget(distDir, version, t, append(binaries[t], extraFiles...))
+		if err != nil {
+			return err
+		}
+
+		UI.Normal().WithStringValue("target", t.String()).WithStringValue("archive", archive).Msg("Packaged.")
+		archives = append(archives, archive)
+	}
+
+	return writeChecksums(filepath.Join(distDir, ChecksumsFile), archives)
+}
+
+func packageTarget(distDir, version string, t Target, files []fsutil.ArchiveFile) (string, error) {
+	arch := t.Arch
+	if t.ARM != "" {
+		arch += "v" + t.ARM
+	}
+	name := fmt.Sprintf("%s_%s_%s_%s", filepath.Base(cwd), version, t.OS, arch)
+
+	if t.OS == osWindows {
+		archive := filepath.Join(distDir, name+".zip")
+		return archive, fsutil.CreateZip(archive, files...)
+	}
+
+	archive := filepath.Join(distDir, name+".tar.gz")
+	return archive, fsutil.CreateTarGz(archive, files...)
+}
+
+// packageFiles returns the files in the working directory that match PackageFiles.
+func packageFiles() ([]fsutil.ArchiveFile, error) {
+	files := []fsutil.ArchiveFile{}
+	for _, pattern := range PackageFiles {
+		matches, err := filepath.Glob(filepath.Join(cwd, pattern))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to glob using pattern '%s'", pattern)
+		}
+
+		for _, m := range matches {
+			if exists, _ := fsutil.FileExists(m); exists {
+				files = append(files, fsutil.ArchiveFile{Path: m, Name: filepath.Base(m)})
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// writeChecksums writes the SHA256 of each file, in the format of 'sha256sum'.
+func writeChecksums(checksumsPath string, files []string) error {
+	sorted := append([]string{}, files...)
+	sort.Strings(sorted)
+
+	lines := []string{}
+	for _, f := range sorted {
+		sum, err := fileSHA256(f)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, sum+"  "+filepath.Base(f))
+	}
+
+	err := os.WriteFile(checksumsPath, []byte(strings.Join(lines, "\n")+"\n"), 0644) //nolint:gosec // checksums are published with the archives
+	if err != nil {
+		return errors.Wrapf(err, "failed to write '%s'", checksumsPath)
+	}
+
+	return nil
+}
+
+func fileSHA256(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to open '%s'", filePath)
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", errors.Wrapf(err, "failed to calculate sha for '%s'", filePath)
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
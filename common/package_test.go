@@ -0,0 +1,118 @@
+package common_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/mage-loot/common"
+)
+
+func tarGzNames(t *testing.T, archive string) []string {
+	t.Helper()
+
+	f, err := os.Open(archive)
+	require.NoError(t, err)
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+
+	names := []string{}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, h.Name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func zipNames(t *testing.T, archive string) []string {
+	t.Helper()
+
+	r, err := zip.OpenReader(archive)
+	require.NoError(t, err)
+	defer r.Close()
+
+	names := []string{}
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func TestPackage(t *testing.T) {
+	assert := require.New(t)
+	dir := gitRepo(t)
+
+	writeFile(t, dir, common.BuildMatrixFile, `
+binaries:
+- package: ./cmd/tool
+targets:
+- linux/amd64
+- linux/arm/7
+- windows/amd64
+`)
+	writeFile(t, dir, "LICENSE", "license")
+	writeFile(t, dir, ".gitignore", "bin/\ndist/\n")
+	git(t, dir, "add", ".")
+	git(t, dir, "commit", "-qm", "add build matrix")
+	git(t, dir, "tag", "v1.2.3")
+
+	writeFile(t, dir, "bin/linux-amd64/tool", "linux amd64")
+	writeFile(t, dir, "bin/linux-armv7/tool", "linux arm 7")
+	writeFile(t, dir, "bin/windows-amd64/tool.exe", "windows amd64")
+
+	assert.NoError(common.Package())
+
+	project := filepath.Base(dir)
+	distDir := filepath.Join(dir, common.DistDir)
+	archives := map[string][]string{
+		project + "_1.2.3_linux_amd64.tar.gz": {"LICENSE", "README.md", "tool"},
+		project + "_1.2.3_linux_armv7.tar.gz": {"LICENSE", "README.md", "tool"},
+		project + "_1.2.3_windows_amd64.zip":  {"LICENSE", "README.md", "tool.exe"},
+	}
+
+	expectedChecksums := []string{}
+	for name, files := range archives {
+		archive := filepath.Join(distDir, name)
+		if strings.HasSuffix(name, ".zip") {
+			assert.Equal(files, zipNames(t, archive))
+		} else {
+			assert.Equal(files, tarGzNames(t, archive))
+		}
+
+		content, err := os.ReadFile(archive)
+		assert.NoError(err)
+		sum := sha256.Sum256(content)
+		expectedChecksums = append(expectedChecksums, hex.EncodeToString(sum[:])+"  "+name)
+	}
+	sort.Slice(expectedChecksums, func(i, j int) bool {
+		return strings.Fields(expectedChecksums[i])[1] < strings.Fields(expectedChecksums[j])[1]
+	})
+
+	checksums, err := os.ReadFile(filepath.Join(distDir, common.ChecksumsFile))
+	assert.NoError(err)
+	assert.Equal(strings.Join(expectedChecksums, "\n")+"\n", string(checksums))
+
+	assert.NoError(os.Remove(filepath.Join(dir, "bin/linux-armv7/tool")))
+	assert.ErrorContains(common.Package(), "please build it first")
+}
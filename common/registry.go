@@ -0,0 +1,165 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aserto-dev/mage-loot/semver"
+	"github.com/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/client"
+	"github.com/docker/distribution/registry/client/auth"
+	"github.com/docker/distribution/registry/client/transport"
+	registrytypes "github.com/docker/docker/api/types/registry"
+	dockerregistry "github.com/docker/docker/registry"
+	"github.com/pkg/errors"
+)
+
+const (
+	dockerHubRegistry = "registry-1.docker.io"
+	registryTimeout   = 30 * time.Second
+)
+
+// DockerTags returns the tags an image of the current version should be pushed with.
+// A release like '1.2.3' is tagged '1.2.3', and also '1.2', '1' and 'latest' if it's the
+// highest version with that prefix in the registry. Other versions only get their own tag.
+// Expects env vars DOCKER_USERNAME and DOCKER_PASSWORD to be set, if the registry requires them.
+func DockerTags(registry, image string) ([]string, error) {
+	return DockerTagsWith(registry, image)
+}
+
+// DockerTagsWith is like DockerTags, with options like WithTagPrefix.
+func DockerTagsWith(registry, image string, options ...VersionOption) ([]string, error) {
+	version, err := VersionWith(options...)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := registryTags(registry, image, os.Getenv("DOCKER_USERNAME"), os.Getenv("DOCKER_PASSWORD"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read tags in registry")
+	}
+
+	return dockerTagsFor(version, existing)
+}
+
+// dockerTagsFor returns the tags for a version, given the tags that already exist in the registry.
+func dockerTagsFor(version string, existing []string) ([]string, error) {
+	v, err := semver.Parse(version)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []string{v.String()}
+	if len(v.PreRelease) != 0 || len(v.Build) != 0 {
+		return tags, nil
+	}
+
+	// highest is true if no released version with the prefix is higher than v.
+	highest := func(matches func(*semver.Version) bool) bool {
+		for _, tag := range existing {
+			other, err := semver.Parse(tag)
+			if err != nil || len(other.PreRelease) != 0 || !matches(other) {
+				continue
+			}
+			if v.LessThan(other) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if highest(func(o *semver.Version) bool { return o.Major == v.Major && o.Minor == v.Minor }) {
+		tags = append(tags, strings.Join(strings.Split(v.String(), ".")[:2], "."))
+	}
+	if highest(func(o *semver.Version) bool { return o.Major == v.Major }) {
+		tags = append(tags, strings.Split(v.String(), ".")[0])
+	}
+	if highest(func(*semver.Version) bool { return true }) {
+		tags = append(tags, "latest")
+	}
+
+	return tags, nil
+}
+
+// registryTags lists the tags of an image using the registry client of docker/distribution,
+// which docker uses too. Registries requiring a bearer token are supported, as well as basic auth.
+// The registry can include the scheme, which defaults to https.
+func registryTags(registry, image, user, password string) ([]string, error) {
+	base := registry
+	if base == "" || base == "docker.io" || base == "index.docker.io" {
+		base = dockerHubRegistry
+		if !strings.Contains(image, "/") {
+			image = "library/" + image
+		}
+	}
+	if !strings.Contains(base, "://") {
+		base = "https://" + base
+	}
+
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid registry '%s'", registry)
+	}
+
+	named, err := reference.WithName(image)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid image '%s'", image)
+	}
+
+	rt := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	challenges, err := dockerregistry.PingV2Registry(baseURL, rt)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to reach registry '%s'", registry)
+	}
+
+	creds := dockerregistry.NewStaticCredentialStore(&registrytypes.AuthConfig{Username: user, Password: password})
+	tokens := auth.NewTokenHandlerWithOptions(auth.TokenHandlerOptions{
+		Transport:   rt,
+		Credentials: creds,
+		Scopes:      []auth.Scope{auth.RepositoryScope{Repository: image, Actions: []string{"pull"}}},
+	})
+	authorizer := auth.NewAuthorizer(challenges, tokens, auth.NewBasicHandler(creds))
+
+	repo, err := client.NewRepository(named, baseURL.String(), transport.NewTransport(rt, authorizer))
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+	defer cancel()
+
+	tags, err := repo.Tags(ctx).All(ctx)
+	if isNameUnknown(err) {
+		// The image hasn't been pushed yet.
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "listing tags of '%s' failed", image)
+	}
+
+	return tags, nil
+}
+
+// isNameUnknown returns true if the registry doesn't know the repository.
+func isNameUnknown(err error) bool {
+	var unexpected *client.UnexpectedHTTPResponseError
+	if errors.As(err, &unexpected) {
+		return unexpected.StatusCode == http.StatusNotFound
+	}
+
+	var errs errcode.Errors
+	if errors.As(err, &errs) {
+		for _, e := range errs {
+			if coder, ok := e.(errcode.ErrorCoder); ok && coder.ErrorCode().String() == "NAME_UNKNOWN" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
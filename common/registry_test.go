@@ -0,0 +1,78 @@
+package common_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/mage-loot/common"
+)
+
+func TestDockerTagsFor(t *testing.T) {
+	assert := require.New(t)
+
+	existing := []string{"1.2.3", "1.2", "1", "latest", "1.3.0", "2.0.0-rc.1", "main"}
+
+	tags, err := common.DockerTagsFor("1.3.1", existing)
+	assert.NoError(err)
+	assert.Equal([]string{"1.3.1", "1.3", "1", "latest"}, tags)
+
+	tags, err = common.DockerTagsFor("1.2.4", existing)
+	assert.NoError(err)
+	assert.Equal([]string{"1.2.4", "1.2"}, tags)
+
+	tags, err = common.DockerTagsFor("1.3.1-2.gabc1234", existing)
+	assert.NoError(err)
+	assert.Equal([]string{"1.3.1-2.gabc1234"}, tags)
+}
+
+func TestRegistryTagsWithToken(t *testing.T) {
+	assert := require.New(t)
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			user, password, ok := r.BasicAuth()
+			if !ok || user != "user" || password != "secret" || !strings.HasPrefix(r.URL.Query().Get("scope"), "repository:org/") {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{"token": "t0ken"})
+		case "/v2/":
+			// Clients ping the registry to find out how to authenticate.
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+srv.URL+`/token",service="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/v2/org/app/tags/list":
+			if r.Header.Get("Authorization") != "Bearer t0ken" {
+				w.Header().Set("WWW-Authenticate",
+					`Bearer realm="`+srv.URL+`/token",service="registry",scope="repository:org/app:pull"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Query().Get("last") == "" {
+				w.Header().Set("Link", `</v2/org/app/tags/list?n=2&last=1.0.1>; rel="next"`)
+				_ = json.NewEncoder(w).Encode(map[string][]string{"tags": {"1.0.0", "1.0.1"}})
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string][]string{"tags": {"latest"}})
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[{"code":"NAME_UNKNOWN","message":"repository name not known to registry"}]}`))
+		}
+	}))
+	defer srv.Close()
+
+	tags, err := common.RegistryTags(srv.URL, "org/app", "user", "secret")
+	assert.NoError(err)
+	assert.Equal([]string{"1.0.0", "1.0.1", "latest"}, tags)
+
+	tags, err = common.RegistryTags(srv.URL, "org/new", "user", "secret")
+	assert.NoError(err)
+	assert.Empty(tags)
+}
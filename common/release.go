@@ -0,0 +1,226 @@
+package common
+
+import (
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// releaseOptions are the options set using ConfigureRelease.
+var releaseOptions = []ReleaseOption{}
+
+// ReleaseOption changes the steps of ReleaseFlow.
+type ReleaseOption func(*releaseFlow)
+
+type releaseFlow struct {
+	bump      string
+	tagPrefix string
+	remote    string
+	test      func() error
+	build     func() error
+	publish   func() error
+	dryRun    bool
+}
+
+// releaseStep is a step of the release flow. Steps that aren't readOnly are skipped in a dry run.
+type releaseStep struct {
+	name     string
+	readOnly bool
+	run      func() error
+}
+
+// WithReleaseBump sets the part of the version that's incremented: 'major', 'minor', 'patch',
+// 'prerelease' or BumpAuto, which is the default.
+func WithReleaseBump(part string) ReleaseOption {
+	return func(f *releaseFlow) {
+		f.bump = part
+	}
+}
+
+// WithReleaseTagPrefix releases a component that's versioned with tags like 'cmd/foo/v1.2.3'.
+func WithReleaseTagPrefix(prefix string) ReleaseOption {
+	return func(f *releaseFlow) {
+		f.tagPrefix = prefix
+	}
+}
+
+// WithReleaseRemote sets the git remote the tag is pushed to, which is 'origin' by default.
+func WithReleaseRemote(remote string) ReleaseOption {
+	return func(f *releaseFlow) {
+		f.remote = remote
+	}
+}
+
+// WithReleaseTest replaces Test as the step that runs the tests.
+func WithReleaseTest(test func() error) ReleaseOption {
+	return func(f *releaseFlow) {
+		f.test = test
+	}
+}
+
+// WithReleaseBuild adds a step that builds the release before the tag is pushed.
+// By default, goreleaser builds the release while publishing it, unless WithReleasePublish
+// replaces it, in which case BuildAll is the default build step.
+func WithReleaseBuild(build func() error) ReleaseOption {
+	return func(f *releaseFlow) {
+		f.build = build
+	}
+}
+
+// WithReleasePublish replaces Release as the step that publishes the release, after the tag is pushed.
+func WithReleasePublish(publish func() error) ReleaseOption {
+	return func(f *releaseFlow) {
+		f.publish = publish
+	}
+}
+
+// ConfigureRelease sets options for ReleaseFlow.
+func ConfigureRelease(options ...ReleaseOption) {
+	releaseOptions = append(releaseOptions, options...)
+}
+
+// ReleaseFlow releases the next version of the project. It makes sure the work tree is clean,
+// runs GitleaksCheck and the tests, computes the next version, tags HEAD, pushes the tag and publishes
+// using goreleaser, which builds the release. If a step fails after HEAD is tagged, the tag is deleted,
+// also from the remote if it was pushed.
+// The args can include '--dry-run' (or the RELEASE_DRY_RUN env var can be set) to only print
+// the steps, and '--bump=<part>' to override the part of the version that's incremented.
+func ReleaseFlow(args ...string) error {
+	flow, err := newReleaseFlow(args)
+	if err != nil {
+		return err
+	}
+
+	return flow.run()
+}
+
+func newReleaseFlow(args []string) (*releaseFlow, error) {
+	_, dryRun := os.LookupEnv("RELEASE_DRY_RUN")
+
+	flow := &releaseFlow{
+		bump:   BumpAuto,
+		remote: "origin",
+		test:   func() error { return Test() },
+		dryRun: dryRun,
+	}
+	for _, o := range releaseOptions {
+		o(flow)
+	}
+
+	// goreleaser builds everything again after cleaning dist, so it's only built separately for another publish step.
+	switch {
+	case flow.publish == nil:
+		flow.publish = func() error { return Release("--clean") }
+	case flow.build == nil:
+		flow.build = func() error { return BuildAll() }
+	}
+
+	for _, arg := range args {
+		switch {
+		case arg == "--dry-run":
+			flow.dryRun = true
+		case strings.HasPrefix(arg, "--bump="):
+			flow.bump = strings.TrimPrefix(arg, "--bump=")
+		default:
+			return nil, errors.Errorf("unknown release argument '%s'", arg)
+		}
+	}
+
+	return flow, nil
+}
+
+func (f *releaseFlow) run() error {
+	var (
+		tag    string
+		tagged bool
+		pushed bool
+	)
+
+	steps := []releaseStep{
+		{name: "check work tree", readOnly: true, run: func() error {
+			dirty, err := WorkTreeDirty()
+			if err != nil {
+				return err
+			}
+			if dirty {
+				return errors.New("the work tree has uncommitted changes, please commit or stash them")
+			}
+			return nil
+		}},
+		{name: "check leaks", readOnly: true, run: GitleaksCheck},
+		{name: "test", run: f.test},
+		{name: "compute version", readOnly: true, run: func() error {
+			version, err := NextVersionWith(f.bump, WithTagPrefix(f.tagPrefix))
+			if err != nil {
+				return err
+			}
+			tag = f.tagPrefix + "v" + version
+			UI.Normal().WithStringValue("tag", tag).Msg("Next version.")
+			return nil
+		}},
+		{name: "tag", run: func() error {
+			if _, err := gitOutput("tag", tag); err != nil {
+				return errors.Wrapf(err, "failed to tag '%s'", tag)
+			}
+			tagged = true
+			return nil
+		}},
+	}
+	if f.build != nil {
+		steps = append(steps, releaseStep{name: "build", run: f.build})
+	}
+	steps = append(steps,
+		releaseStep{name: "push tag", run: func() error {
+			if _, err := gitOutput("push", f.remote, tag); err != nil {
+				return errors.Wrapf(err, "failed to push tag [%s] to remote [%s]", tag, f.remote)
+			}
+			pushed = true
+			return nil
+		}},
+		releaseStep{name: "publish", run: f.publish},
+	)
+
+	for i, step := range steps {
+		msg := UI.Normal().WithStringValue("step", step.name).WithIntValue("n", int64(i+1)).WithIntValue("of", int64(len(steps)))
+		if f.dryRun && !step.readOnly {
+			msg.Msg("Dry run, skipping.")
+			continue
+		}
+		msg.Msg("Release step.")
+
+		if err := step.run(); err != nil {
+			if tagged {
+				f.rollback(tag, pushed)
+			}
+			return errors.Wrapf(err, "release step '%s' failed", step.name)
+		}
+	}
+
+	if f.dryRun {
+		UI.Normal().WithStringValue("tag", tag).Msg("Dry run done, nothing was released.")
+	} else {
+		UI.Normal().WithStringValue("tag", tag).Msg("Released.")
+	}
+
+	return nil
+}
+
+// rollback deletes the tag, first from the remote if it was pushed.
+// If it can't be deleted from the remote, the local tag is kept too.
+func (f *releaseFlow) rollback(tag string, pushed bool) {
+	if pushed {
+		if _, err := gitOutput("push", f.remote, ":refs/tags/"+tag); err != nil {
+			UI.Problem().WithErr(err).WithStringValue("remote", f.remote).
+				Msgf("Failed to delete tag '%s' from the remote, please delete it there and locally.", tag)
+			return
+		}
+		UI.Exclamation().WithStringValue("tag", tag).WithStringValue("remote", f.remote).Msg("Deleted the remote tag.")
+	}
+
+	if _, err := gitOutput("tag", "-d", tag); err != nil {
+		UI.Problem().WithErr(err).Msgf("Failed to delete tag '%s'.", tag)
+		return
+	}
+	UI.Exclamation().WithStringValue("tag", tag).Msg("Deleted the local tag.")
+}
@@ -0,0 +1,129 @@
+package common_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/mage-loot/common"
+)
+
+func TestReleaseFlow(t *testing.T) {
+	assert := require.New(t)
+	dir := gitRepo(t)
+
+	remote := t.TempDir()
+	git(t, remote, "init", "-q", "--bare")
+	git(t, dir, "remote", "add", "origin", remote)
+
+	git(t, dir, "tag", "v1.2.3")
+	git(t, dir, "commit", "-q", "--allow-empty", "-m", "feat: add releases")
+
+	steps := []string{}
+	step := func(name string, err error) func() error {
+		return func() error {
+			steps = append(steps, name)
+			return err
+		}
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		steps = nil
+		t.Cleanup(common.SetReleaseOptions(
+			common.WithReleaseTest(step("test", nil)),
+			common.WithReleaseBuild(step("build", nil)),
+			common.WithReleasePublish(step("publish", nil)),
+		))
+
+		var err error
+		out := captureOutput(t, func() { err = common.ReleaseFlow("--dry-run") })
+		assert.NoError(err)
+		assert.Empty(steps)
+
+		// The checks don't change anything, so they run in a dry run too.
+		for _, name := range []string{"check work tree", "check leaks", "compute version"} {
+			assert.Contains(out, "Release step.\nstep: "+name+"\n")
+		}
+		assert.Contains(out, "Dry run, skipping.\nstep: tag\n")
+		assert.Contains(out, "Dry run, skipping.\nstep: push tag\n")
+		assert.Empty(strings.TrimSpace(git(t, dir, "tag", "--list", "v1.3.0")))
+	})
+
+	t.Run("dirty work tree", func(t *testing.T) {
+		steps = nil
+		t.Cleanup(common.SetReleaseOptions(common.WithReleaseTest(step("test", nil))))
+
+		writeFile(t, dir, "README.md", "changed")
+		t.Cleanup(func() { git(t, dir, "checkout", "README.md") })
+
+		err := common.ReleaseFlow()
+		assert.ErrorContains(err, "uncommitted changes")
+		assert.Empty(steps)
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		steps = nil
+		t.Cleanup(common.SetReleaseOptions(
+			common.WithReleaseTest(step("test", nil)),
+			common.WithReleaseBuild(step("build", errors.New("boom"))),
+			common.WithReleasePublish(step("publish", nil)),
+		))
+
+		err := common.ReleaseFlow("--bump=patch")
+		assert.ErrorContains(err, "release step 'build' failed")
+		assert.Equal([]string{"test", "build"}, steps)
+		assert.Empty(strings.TrimSpace(git(t, dir, "tag", "--list", "v1.2.4")))
+	})
+
+	t.Run("rollback after push", func(t *testing.T) {
+		steps = nil
+		t.Cleanup(common.SetReleaseOptions(
+			common.WithReleaseTest(step("test", nil)),
+			common.WithReleaseBuild(step("build", nil)),
+			common.WithReleasePublish(step("publish", errors.New("boom"))),
+		))
+
+		err := common.ReleaseFlow("--bump=patch")
+		assert.ErrorContains(err, "release step 'publish' failed")
+		assert.Equal([]string{"test", "build", "publish"}, steps)
+		assert.Empty(strings.TrimSpace(git(t, dir, "tag", "--list", "v1.2.4")))
+		assert.NotContains(git(t, remote, "tag", "--list"), "v1.2.4")
+	})
+
+	t.Run("release", func(t *testing.T) {
+		steps = nil
+		t.Cleanup(common.SetReleaseOptions(
+			common.WithReleaseTest(step("test", nil)),
+			common.WithReleaseBuild(step("build", nil)),
+			common.WithReleasePublish(step("publish", nil)),
+		))
+
+		assert.NoError(common.ReleaseFlow())
+		assert.Equal([]string{"test", "build", "publish"}, steps)
+		assert.Equal("v1.3.0", strings.TrimSpace(git(t, dir, "tag", "--points-at", "HEAD")))
+		assert.Contains(git(t, remote, "tag", "--list"), "v1.3.0")
+	})
+
+	t.Run("goreleaser", func(t *testing.T) {
+		steps = nil
+		t.Cleanup(common.SetReleaseOptions(common.WithReleaseTest(step("test", nil))))
+
+		calls := []string{}
+		t.Cleanup(common.SetGoreleaser(func(args ...string) error {
+			calls = append(calls, strings.Join(args, " "))
+			return nil
+		}))
+
+		// goreleaser builds the release, so there's no separate build step.
+		assert.NoError(common.ReleaseFlow("--bump=patch"))
+		assert.Equal([]string{"test"}, steps)
+		assert.Equal([]string{"release --clean"}, calls)
+		assert.Contains(git(t, remote, "tag", "--list"), "v1.3.1")
+	})
+
+	t.Run("unknown argument", func(t *testing.T) {
+		assert.ErrorContains(common.ReleaseFlow("--publish-later"), "unknown release argument")
+	})
+}
@@ -1,15 +1,33 @@
 package common
 
 import (
+	"strconv"
 	"strings"
 
-	"github.com/aserto-dev/mage-loot/deps"
+	"github.com/aserto-dev/mage-loot/semver"
 	"github.com/magefile/mage/sh"
 	"github.com/pkg/errors"
 )
 
+const dirtyIdentifier = "dirty"
+
+type versionOptions struct {
+	tagPrefix string
+}
+
+// VersionOption changes how versions are read from git tags.
+type VersionOption func(*versionOptions)
+
+// WithTagPrefix only considers tags with the given prefix, for repos that version
+// several components separately. With the prefix 'cmd/foo/', 'cmd/foo/v1.2.3' is version '1.2.3'.
+func WithTagPrefix(prefix string) VersionOption {
+	return func(o *versionOptions) {
+		o.tagPrefix = prefix
+	}
+}
+
 func Commit() (string, error) {
-	out, err := sh.Output("git", "rev-parse", "--short", "HEAD")
+	out, err := gitOutput("rev-parse", "--short", "HEAD")
 	if err != nil {
 		return "", errors.Wrap(err, "please make sure this is a git repo - failed to determine commit")
 	}
@@ -17,24 +35,169 @@ func Commit() (string, error) {
 	return out, nil
 }
 
+// Version returns the version of HEAD, based on the highest semver tag it contains.
+// If HEAD is tagged and the work tree is clean, it's the version of the tag, like '1.2.3'.
+// Otherwise it's a pre-release of the next patch version, with the number of commits since the tag
+// and the commit, like '1.2.4-5.gabc1234'. Pre-release tags are extended instead, like
+// '1.3.0-rc.1.5.gabc1234'. A dirty work tree adds the 'dirty' identifier, like '1.2.4-0.gabc1234.dirty'.
 func Version() (string, error) {
-	out, err := deps.GoDepOutput("sver")()
+	return VersionWith()
+}
+
+// VersionWith is like Version, with options like WithTagPrefix.
+func VersionWith(options ...VersionOption) (string, error) {
+	v, err := headVersion(options...)
 	if err != nil {
 		return "", errors.Wrap(err, "please make sure you have a valid tag - failed to determine version")
 	}
 
-	return out, nil
+	return v.String(), nil
 }
 
+// NextVersion returns the version after the highest semver tag, incrementing the given part:
+// 'major', 'minor', 'patch' or 'prerelease'. See semver.Version.Next.
+// With BumpAuto, the part is picked from the conventional commits since the tag. See BumpFor.
 func NextVersion(part string) (string, error) {
-	out, err := deps.GoDepOutput("sver")("--next", part)
+	return NextVersionWith(part)
+}
+
+// NextVersionWith is like NextVersion, with options like WithTagPrefix.
+func NextVersionWith(part string, options ...VersionOption) (string, error) {
+	_, current, err := LatestVersionTag(options...)
 	if err != nil {
 		return "", errors.Wrap(err, "please make sure you have a valid tag - failed to determine version")
 	}
 
-	return out, nil
+	if part == BumpAuto {
+		commits, err := CommitsSinceLatestTag(options...)
+		if err != nil {
+			return "", err
+		}
+		part = BumpFor(commits)
+	}
+
+	next, err := current.Next(part)
+	if err != nil {
+		return "", err
+	}
+
+	return next.String(), nil
 }
 
+// LatestVersionTag returns the highest semver tag reachable from HEAD and its version.
+// If there's none, the tag is empty and the version is '0.0.0'.
+func LatestVersionTag(options ...VersionOption) (string, *semver.Version, error) {
+	opts := resolveVersionOptions(options)
+
+	out, err := gitOutput("tag", "--list", opts.tagPrefix+"*", "--merged", "HEAD")
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to list tags")
+	}
+
+	latestTag, latest := "", &semver.Version{}
+	for _, tag := range strings.Split(out, "\n") {
+		tag = strings.TrimSpace(tag)
+		v, err := semver.Parse(strings.TrimPrefix(tag, opts.tagPrefix))
+		if tag == "" || err != nil {
+			continue
+		}
+
+		if latestTag == "" || latest.LessThan(v) {
+			latestTag, latest = tag, v
+		}
+	}
+
+	return latestTag, latest, nil
+}
+
+// IsDirty returns true if a version was computed from a work tree with uncommitted changes.
 func IsDirty(version string) bool {
-	return strings.Contains(version, "-dirty")
+	v, err := semver.Parse(version)
+	if err != nil {
+		return strings.Contains(version, "-"+dirtyIdentifier)
+	}
+
+	for _, id := range append(v.PreRelease, v.Build...) {
+		if id == dirtyIdentifier {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WorkTreeDirty returns true if there are uncommitted changes, including untracked files that aren't ignored.
+func WorkTreeDirty() (bool, error) {
+	out, err := gitOutput("status", "--porcelain")
+	if err != nil {
+		return false, errors.Wrap(err, "failed to determine git status")
+	}
+
+	return strings.TrimSpace(out) != "", nil
+}
+
+func headVersion(options ...VersionOption) (*semver.Version, error) {
+	tag, latest, err := LatestVersionTag(options...)
+	if err != nil {
+		return nil, err
+	}
+
+	dirty, err := WorkTreeDirty()
+	if err != nil {
+		return nil, err
+	}
+
+	commits, err := commitsSince(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	if commits == 0 && tag != "" && !dirty {
+		return latest, nil
+	}
+
+	commit, err := Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	v := &semver.Version{Major: latest.Major, Minor: latest.Minor, Patch: latest.Patch, PreRelease: latest.PreRelease}
+	if len(v.PreRelease) == 0 {
+		v.Patch++
+	}
+	v.PreRelease = append(append([]string{}, v.PreRelease...), strconv.Itoa(commits), "g"+commit)
+	if dirty {
+		v.PreRelease = append(v.PreRelease, dirtyIdentifier)
+	}
+
+	return v, nil
+}
+
+// commitsSince counts the commits between the tag and HEAD, or all commits if the tag is empty.
+func commitsSince(tag string) (int, error) {
+	revs := "HEAD"
+	if tag != "" {
+		revs = tag + "..HEAD"
+	}
+
+	out, err := gitOutput("rev-list", "--count", revs)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to count commits")
+	}
+
+	return strconv.Atoi(strings.TrimSpace(out))
+}
+
+func resolveVersionOptions(options []VersionOption) *versionOptions {
+	opts := &versionOptions{}
+	for _, o := range options {
+		o(opts)
+	}
+
+	return opts
+}
+
+// gitOutput runs git in the working directory and returns its output.
+func gitOutput(args ...string) (string, error) {
+	return sh.Output("git", append([]string{"-C", cwd}, args...)...)
 }
@@ -0,0 +1,90 @@
+package common_test
+
+import (
+	"os/exec"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/mage-loot/common"
+)
+
+func TestVersionFromTags(t *testing.T) {
+	assert := require.New(t)
+	dir := gitRepo(t)
+
+	version, err := common.Version()
+	assert.NoError(err)
+	assert.Regexp(regexp.MustCompile(`^0\.0\.1-1\.g[0-9a-f]+$`), version)
+
+	git(t, dir, "tag", "v1.2.3")
+	git(t, dir, "tag", "cmd/agent/v0.4.0")
+	git(t, dir, "tag", "not-a-version")
+
+	version, err = common.Version()
+	assert.NoError(err)
+	assert.Equal("1.2.3", version)
+	assert.False(common.IsDirty(version))
+
+	version, err = common.VersionWith(common.WithTagPrefix("cmd/agent/"))
+	assert.NoError(err)
+	assert.Equal("0.4.0", version)
+
+	next, err := common.NextVersion("minor")
+	assert.NoError(err)
+	assert.Equal("1.3.0", next)
+
+	next, err = common.NextVersionWith("patch", common.WithTagPrefix("cmd/agent/"))
+	assert.NoError(err)
+	assert.Equal("0.4.1", next)
+
+	writeFile(t, dir, "README.md", "changed")
+	version, err = common.Version()
+	assert.NoError(err)
+	assert.Regexp(regexp.MustCompile(`^1\.2\.4-0\.g[0-9a-f]+\.dirty$`), version)
+	assert.True(common.IsDirty(version))
+
+	git(t, dir, "commit", "-qam", "change")
+	git(t, dir, "commit", "-q", "--allow-empty", "-m", "another change")
+	version, err = common.Version()
+	assert.NoError(err)
+	assert.Regexp(regexp.MustCompile(`^1\.2\.4-2\.g[0-9a-f]+$`), version)
+
+	git(t, dir, "tag", "v1.3.0-rc.1")
+	git(t, dir, "commit", "-q", "--allow-empty", "-m", "fix")
+	version, err = common.Version()
+	assert.NoError(err)
+	assert.Regexp(regexp.MustCompile(`^1\.3\.0-rc\.1\.1\.g[0-9a-f]+$`), version)
+}
+
+// gitRepo creates a git repo with a single commit and makes it the working directory.
+func gitRepo(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Cleanup(common.SetWorkDir(dir))
+
+	for _, v := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(v, "test")
+	}
+	for _, v := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(v, "test@example.com")
+	}
+
+	git(t, dir, "init", "-q", "-b", "main")
+	writeFile(t, dir, "README.md", "# test")
+	git(t, dir, "add", ".")
+	git(t, dir, "commit", "-qm", "initial commit")
+
+	return dir
+}
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	return string(out)
+}
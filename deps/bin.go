@@ -3,8 +3,8 @@ package deps
 import (
 	"io"
 	"os"
-	"path"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/aserto-dev/mage-loot/fsutil"
@@ -12,14 +12,6 @@ import (
 	"github.com/pkg/errors"
 )
 
-const (
-	zipExt = ".zip"
-	tgzExt = ".tgz"
-	gzExt  = ".gz"
-	txzExt = ".txz"
-	xzExt  = ".xz"
-)
-
 // DefBinDep makes sure a dependency is downloaded and makes it available as
 // a runnable command.
 func DefBinDep(name, url, version, sha, entrypoint string, options ...Option) {
@@ -31,189 +23,190 @@ func DefBinDep(name, url, version, sha, entrypoint string, options ...Option) {
 	}
 
 	var ops depOptions
+	for _, o := range options {
+		o(&ops)
+	}
 
-	config.Bin[name].Procure = func() {
-		for _, o := range options {
-			o(&ops)
-		}
-
-		binPath := binFilePath(name, version)
+	// Windows executables need the '.exe' extension, even if the Depfile leaves it out.
+	entrypoint = exeName(entrypoint)
 
-		// downloading an archive
-		entrypointPath := filepath.Join(binPath, entrypoint)
+	binPath := binFilePath(name, version)
 
-		config.Bin[name].Path = entrypointPath
+	// The paths don't depend on procurement, so they're resolved once here instead of
+	// in Procure, which can run concurrently.
+	entrypoints := map[string]string{}
+	for entry, file := range ops.entrypoints {
+		entrypoints[entry] = filepath.Join(binPath, exeName(file))
+	}
+	config.Bin[name].Path = filepath.Join(binPath, entrypoint)
+	config.Bin[name].Entrypoints = entrypoints
 
-		exists, err := fsutil.DirExists(binPath)
-		if err != nil {
-			panic(errors.Wrapf(err, "failed to determine if bin '%s' exists", binPath))
-		}
-		if exists {
+	config.Bin[name].Procure = func() {
+		if isProcured(binPath) {
+			cacheHit(kindBin, name, binPath)
 			return
 		}
 
 		config.Bin[name].Once.Do(func() {
-			if len(ops.zipPaths) != 0 && path.Ext(url) == zipExt {
-				downloadZippedBin(name, url, version, sha, ops.zipPaths)
+			unlock := lockDep(kindBin, filepath.Base(binPath))
+			defer unlock()
+
+			// Another process may have procured the dependency while we were waiting for the lock.
+			if isProcured(binPath) {
 				return
 			}
 
-			if len(ops.tgzPaths) != 0 && (path.Ext(url) == tgzExt || path.Ext(url) == gzExt) {
-				downloadTgzBin(name, url, version, sha, ops.tgzPaths)
-				return
+			stagingDir := mkTmpDir()
+			defer os.RemoveAll(stagingDir)
+
+			format := archiveFormat(url, ops.format)
+			switch {
+			case len(ops.zipPaths) != 0 && format == FormatZip:
+				downloadBin(name, url, sha, format, stagingDir, ops.zipPaths, ops.headers)
+			case len(ops.tgzPaths) != 0 && format == FormatTGz:
+				downloadBin(name, url, sha, format, stagingDir, ops.tgzPaths, ops.headers)
+			case len(ops.txzPaths) != 0 && format == FormatTXz:
+				downloadBin(name, url, sha, format, stagingDir, ops.txzPaths, ops.headers)
+			default:
+				// Default to a simple binary
+				downloadBinary(name, entrypoint, url, sha, stagingDir, ops.headers)
 			}
 
-			if len(ops.txzPaths) != 0 && (path.Ext(url) == txzExt || path.Ext(url) == xzExt) {
-				downloadTxzBin(name, url, version, sha, ops.txzPaths)
-				return
+			ensureEntrypoints(name, stagingDir, entrypoint, ops.entrypoints)
+
+			runPostInstall(name, stagingDir, ops.postInstall)
+
+			if ops.versionCheck != nil {
+				err := checkVersion(filepath.Join(stagingDir, entrypoint), version, ops.versionCheck)
+				if err != nil {
+					panic(errors.Wrapf(err, "version check of bin '%s' failed", name))
+				}
 			}
 
-			// Default to a simple binary
-			downloadBinary(name, entrypoint, url, version, sha)
+			commitProcured(stagingDir, binPath)
 		})
-
-		makeExe(entrypointPath)
 	}
 }
 
 // BinExec returns a command for running a binary dependency.
 // Its stdout and stderr are pipeped to the given writers.
+// The name can refer to a named entrypoint using 'name:entrypoint'.
 func BinExec(name string, stdout, stderr io.Writer) func(...string) error {
-	def := config.Bin[name]
-
-	if def == nil {
-		panic(errors.Errorf("didn't find a binary dependency named '%s'", name))
-	}
+	def, entry := lookupBinDep(name)
 
 	return func(args ...string) error {
-		if !skipProcurement {
-			def.Procure()
-		}
-
-		_, err := sh.Exec(nil, stdout, stderr, name, args...)
+		_, err := sh.Exec(nil, stdout, stderr, procureBinDep(name, def, entry), args...)
 		return err
 	}
 }
 
 // BinDep returns a command for running a binary dependency.
 // Its output is sent to stdout.
+// The name can refer to a named entrypoint using 'name:entrypoint'.
 func BinDep(name string) func(...string) error {
-	def := config.Bin[name]
-
-	if def == nil {
-		panic(errors.Errorf("didn't find a binary dependency named '%s'", name))
-	}
+	def, entry := lookupBinDep(name)
 
 	return func(args ...string) error {
-		if !skipProcurement {
-			def.Procure()
-		}
-
-		return sh.RunV(def.Path, args...)
+		return sh.RunV(procureBinDep(name, def, entry), args...)
 	}
 }
 
 // BinDepWithEnv returns a command for running a binary dependency.
 // It accepts an env map for the new process. Its output is sent to stdout.
+// The name can refer to a named entrypoint using 'name:entrypoint'.
 func BinDepWithEnv(env map[string]string, name string) func(...string) error {
-	def := config.Bin[name]
-
-	if def == nil {
-		panic(errors.Errorf("didn't find a binary dependency named '%s'", name))
-	}
+	def, entry := lookupBinDep(name)
 
 	return func(args ...string) error {
-		if !skipProcurement {
-			def.Procure()
-		}
-
-		return sh.RunWithV(env, name, args...)
+		return sh.RunWithV(env, procureBinDep(name, def, entry), args...)
 	}
 }
 
 // BinDepOut returns a command for running a binary dependency.
 // Its output is returned.
+// The name can refer to a named entrypoint using 'name:entrypoint'.
 func BinDepOut(name string) func(...string) (string, error) {
-	def := config.Bin[name]
-
-	if def == nil {
-		panic(errors.Errorf("didn't find a binary dependency named '%s'", name))
-	}
+	def, entry := lookupBinDep(name)
 
 	return func(args ...string) (string, error) {
-		if !skipProcurement {
-			def.Procure()
-		}
-
-		return sh.Output(def.Path, args...)
+		return sh.Output(procureBinDep(name, def, entry), args...)
 	}
 }
 
 // BinDepOutWithEnv returns a command for running a binary dependency.
 // It accepts an env map for the new process. Its output is returned.
+// The name can refer to a named entrypoint using 'name:entrypoint'.
 func BinDepOutWithEnv(env map[string]string, name string) func(...string) (string, error) {
-	def := config.Bin[name]
-
-	if def == nil {
-		panic(errors.Errorf("didn't find a binary dependency named '%s'", name))
-	}
+	def, entry := lookupBinDep(name)
 
 	return func(args ...string) (string, error) {
-		if !skipProcurement {
-			def.Procure()
-		}
-
-		return sh.OutputWith(env, def.Path, args...)
+		return sh.OutputWith(env, procureBinDep(name, def, entry), args...)
 	}
 }
 
+// BinPath returns the path to a binary dependency, procuring it if needed.
+// The name can refer to a named entrypoint using 'name:entrypoint'.
 func BinPath(name string) string {
-	def := config.Bin[name]
+	def, entry := lookupBinDep(name)
+
+	return procureBinDep(name, def, entry)
+}
 
+// lookupBinDep finds the binary dependency referenced by 'name' or 'name:entrypoint'.
+func lookupBinDep(ref string) (*depDetails, string) {
+	name, entry, _ := strings.Cut(ref, ":")
+
+	def := config.Bin[name]
 	if def == nil {
 		panic(errors.Errorf("didn't find a binary dependency named '%s'", name))
 	}
 
+	return def, entry
+}
+
+// procureBinDep procures a binary dependency and returns the path of the requested entrypoint.
+// An empty entry refers to the main entrypoint.
+func procureBinDep(ref string, def *depDetails, entry string) string {
 	if !skipProcurement {
 		def.Procure()
 	}
 
-	return def.Path
-}
-
-func downloadTgzBin(name, url, version, sha string, patterns []string) {
-	downloadBin(name, url, version, sha, "tgz", patterns)
-}
+	if entry == "" {
+		return def.Path
+	}
 
-func downloadTxzBin(name, url, version, sha string, patterns []string) {
-	downloadBin(name, url, version, sha, "txz", patterns)
-}
+	entryPath, ok := def.Entrypoints[entry]
+	if !ok {
+		panic(errors.Errorf("didn't find an entrypoint for binary dependency '%s'", ref))
+	}
 
-func downloadZippedBin(name, url, version, sha string, patterns []string) {
-	downloadBin(name, url, version, sha, "zip", patterns)
+	return entryPath
 }
 
-func downloadBin(name, url, version, sha, extension string, patterns []string) {
+func downloadBin(name, url, sha, extension, binDir string, patterns []string, headers map[string]string) {
 	filePath := tmpFile(name + "." + extension)
 	defer os.RemoveAll(filepath.Dir(filePath))
 
-	ui.Note().WithStringValue(extension, name).WithStringValue("url", url).Msg("Downloading ...")
-	err := downloadFile(filePath, url)
+	err := downloadFile(kindBin, name, filePath, url, headers)
 	if err != nil {
 		panic(errors.Wrap(err, "failed to download file"))
 	}
 
-	ui.Note().WithStringValue(extension, name).Msg("Checking signature ...")
-	verifyFile(filePath, sha)
+	verifyFile(kindBin, name, filePath, sha)
 
 	unpackDir := mkTmpDir()
 	defer os.RemoveAll(unpackDir)
 
-	err = fsutil.Extract(extension, filePath, unpackDir)
+	err = extractArchive(kindBin, name, extension, filePath, unpackDir)
 	if err != nil {
 		panic(errors.Wrapf(err, "failed to unpack '%s'", filePath))
 	}
 
+	err = os.MkdirAll(binDir, 0700)
+	if err != nil {
+		panic(errors.Wrapf(err, "failed to create directory '%s'", binDir))
+	}
+
 	for _, pattern := range patterns {
 		matches, err := filepath.Glob(filepath.Join(unpackDir, pattern))
 		if err != nil {
@@ -221,47 +214,63 @@ func downloadBin(name, url, version, sha, extension string, patterns []string) {
 		}
 
 		for _, m := range matches {
-			binDir := binFilePath(name, version)
-			err = os.MkdirAll(binDir, 0700)
-			if err != nil {
-				panic(errors.Wrapf(err, "failed to create directory '%s'", binDir))
-			}
 			binPath := filepath.Join(binDir, filepath.Base(m))
 
 			err = os.Rename(m, binPath)
 			if err != nil {
 				panic(errors.Wrapf(err, "failed to move binary '%s' to final location", m))
 			}
+
+			makeExe(binPath)
 		}
 	}
 }
 
-func downloadBinary(name, entrypoint, url, version, sha string) {
-	dirPath := binFilePath(name, version)
-
-	err := os.MkdirAll(dirPath, 0700)
+func downloadBinary(name, entrypoint, url, sha, binDir string, headers map[string]string) {
+	err := os.MkdirAll(binDir, 0700)
 	if err != nil {
 		panic(errors.Wrap(err, "failed to create dir for binary"))
 	}
 
-	binPath := filepath.Join(dirPath, entrypoint)
-	ui.Note().WithStringValue("bin", name).WithStringValue("url", url).Msg("Downloading ...")
-	err = downloadFile(binPath, url)
+	binPath := filepath.Join(binDir, entrypoint)
+	err = downloadFile(kindBin, name, binPath, url, headers)
 	if err != nil {
 		panic(errors.Wrap(err, "failed to download file"))
 	}
 
-	ui.Note().WithStringValue("bin", name).Msg("Checking signature ...")
-	verifyFile(binPath, sha)
+	verifyFile(kindBin, name, binPath, sha)
 
 	makeExe(binPath)
 }
 
+// ensureEntrypoints makes sure the main and all named entrypoints were installed to binDir.
+func ensureEntrypoints(name, binDir, entrypoint string, entrypoints map[string]string) {
+	files := []string{entrypoint}
+	for _, file := range entrypoints {
+		files = append(files, exeName(file))
+	}
+
+	for _, file := range files {
+		exists, err := fsutil.FileExists(filepath.Join(binDir, file))
+		if err != nil {
+			panic(errors.Wrapf(err, "failed to determine if entrypoint '%s' of bin '%s' exists", file, name))
+		}
+		if !exists {
+			panic(errors.Errorf("entrypoint '%s' of bin '%s' wasn't installed", file, name))
+		}
+	}
+}
+
 func binFilePath(name, version string) string {
 	return filepath.Join(BinDir(), name+"-"+version)
 }
 
+// makeExe makes a file executable. Windows executables only need the '.exe' extension.
 func makeExe(exePath string) {
+	if goos == osWindows {
+		return
+	}
+
 	err := os.Chmod(exePath, 0700)
 	if err != nil {
 		panic(errors.Wrapf(err, "failed to chmod file '%s'", exePath))
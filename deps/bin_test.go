@@ -0,0 +1,66 @@
+package deps_test
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/mage-loot/deps"
+)
+
+func TestBinEntrypoints(t *testing.T) {
+	assert := require.New(t)
+	deps.SetListener(deps.NopListener{})
+	deps.SetCurrentDir(t.TempDir())
+	defer deps.SetPlatform("linux", "amd64")()
+
+	archive := tgz(t, map[string]string{
+		"multi/bin/multi":        "main",
+		"multi/bin/multi-helper": "helper",
+	})
+	srv, downloads, sha := binServer(t, archive)
+
+	deps.DefBinDep("multi", srv.URL+"/multi.tgz", "1.0.0", sha, "multi",
+		deps.WithTGzPaths("multi/bin/*"),
+		deps.WithEntrypoints(map[string]string{"helper": "multi-helper"}),
+	)
+
+	// Dependencies are procured concurrently by mg.Deps.
+	var wg sync.WaitGroup
+	paths := make([]string, 8)
+	for i := range paths {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ref := "multi"
+			if i%2 == 1 {
+				ref = "multi:helper"
+			}
+			paths[i] = deps.BinPath(ref)
+		}(i)
+	}
+	wg.Wait()
+
+	binDir := filepath.Join(deps.BinDir(), "multi-1.0.0")
+	for i, p := range paths {
+		if i%2 == 1 {
+			assert.Equal(filepath.Join(binDir, "multi-helper"), p)
+		} else {
+			assert.Equal(filepath.Join(binDir, "multi"), p)
+		}
+	}
+	assert.Equal(int32(1), atomic.LoadInt32(downloads))
+
+	content, err := os.ReadFile(deps.BinPath("multi:helper"))
+	assert.NoError(err)
+	assert.Equal("helper", string(content))
+
+	assert.PanicsWithError("didn't find an entrypoint for binary dependency 'multi:missing'", func() {
+		deps.BinPath("multi:missing")
+	})
+	assert.Panics(func() { deps.BinPath("missing:helper") })
+}
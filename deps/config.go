@@ -3,7 +3,6 @@ package deps
 import (
 	"os"
 	"path/filepath"
-	"runtime"
 	"sync"
 
 	"github.com/aserto-dev/clui"
@@ -13,28 +12,55 @@ import (
 )
 
 type depFile struct {
-	Go  map[string]goConfig  `yaml:"go"`
-	Bin map[string]binConfig `yaml:"bin"`
-	Lib map[string]libConfig `yaml:"lib"`
+	Go    map[string]GoSpec    `yaml:"go"`
+	Bin   map[string]BinSpec   `yaml:"bin"`
+	Lib   map[string]LibSpec   `yaml:"lib"`
+	Image map[string]ImageSpec `yaml:"image"`
 }
 
-type goConfig struct {
+// GoSpec is a go tool installed using 'go install', like a 'go' entry in the Depfile.
+type GoSpec struct {
 	ImportPath string `yaml:"importPath"`
 	Version    string `yaml:"version"`
+	// Entrypoint is the name of the installed binary. It defaults to the name of the dependency.
 	Entrypoint string `yaml:"entrypoint"`
+	// Probe are the arguments used by Status to check that the binary runs.
+	Probe []string `yaml:"probe"`
 }
 
-type binConfig struct {
-	Version    string            `yaml:"version"`
-	URL        string            `yaml:"url"`
-	Entrypoint string            `yaml:"entrypoint"`
-	SHA        map[string]string `yaml:"sha"`
-	ZipPaths   []string          `yaml:"zipPaths"`
-	TGzPaths   []string          `yaml:"tgzPaths"`
-	TXzPaths   []string          `yaml:"txzPaths"`
+// BinSpec is a downloaded binary, like a 'bin' entry in the Depfile.
+// The URL, entrypoints, paths and post install commands can use the
+// {{.Version}}, {{.OS}} and {{.Arch}} templates.
+type BinSpec struct {
+	Version string `yaml:"version"`
+	URL     string `yaml:"url"`
+	// Entrypoint is the main executable. It defaults to the name of the dependency.
+	Entrypoint string `yaml:"entrypoint"`
+	// Entrypoints are additional executables, which can be run using 'name:entrypoint'.
+	Entrypoints map[string]string `yaml:"entrypoints"`
+	// SHA are the SHA256 hashes of the download, by platform (like 'linux-amd64').
+	SHA      map[string]string `yaml:"sha"`
+	ZipPaths []string          `yaml:"zipPaths"`
+	TGzPaths []string          `yaml:"tgzPaths"`
+	TXzPaths []string          `yaml:"txzPaths"`
+	// Format overrides the format guessed from the URL's extension. See WithFormat.
+	Format string `yaml:"format"`
+	// Headers are added to the download request. See WithHeaders.
+	Headers      map[string]string `yaml:"headers"`
+	Probe        []string          `yaml:"probe"`
+	PostInstall  []string          `yaml:"postInstall"`
+	VersionCheck *VersionCheck     `yaml:"versionCheck"`
+}
+
+// VersionCheck verifies the version a binary reports. See WithVersionCheck.
+type VersionCheck struct {
+	Args  []string `yaml:"args"`
+	Regex string   `yaml:"regex"`
 }
 
-type libConfig struct {
+// LibSpec is a library, like a 'lib' entry in the Depfile. It's downloaded from URL,
+// cloned from a git repository if Git is set, or synced from a local Path.
+type LibSpec struct {
 	Version   string   `yaml:"version"`
 	URL       string   `yaml:"url"`
 	OutputDir string   `yaml:"outputDir"`
@@ -43,6 +69,22 @@ type libConfig struct {
 	TGzPaths  []string `yaml:"tgzPaths"`
 	TXzPaths  []string `yaml:"txzPaths"`
 	LibPrefix string   `yaml:"libPrefix"`
+	// Format overrides the format guessed from the URL's extension. See WithFormat.
+	Format string `yaml:"format"`
+	// Headers are added to the download request. See WithHeaders.
+	Headers map[string]string `yaml:"headers"`
+	Git     *GitSpec          `yaml:"git"`
+	// Path is a local directory, relative to the Depfile.
+	Path string `yaml:"path"`
+}
+
+// GitSpec is the git repository a lib is cloned from.
+type GitSpec struct {
+	Repo string `yaml:"repo"`
+	// Ref is a commit, tag or branch.
+	Ref string `yaml:"ref"`
+	// Paths are glob patterns of the files to copy.
+	Paths []string `yaml:"paths"`
 }
 
 type depsConfig struct {
@@ -55,6 +97,8 @@ type depDetails struct {
 	Procure func()
 	Once    *sync.Once
 	Path    string
+	// Entrypoints are the paths of named entrypoints, besides the main one at Path.
+	Entrypoints map[string]string
 }
 
 var (
@@ -64,6 +108,9 @@ var (
 		Lib: map[string]*depDetails{},
 	}
 
+	// depFileConfig is the parsed Depfile, or nil if there's none.
+	depFileConfig *depFile
+
 	skipProcurement  = false
 	cmdRegisterMutex = &sync.Mutex{}
 	ui               = clui.NewUI()
@@ -145,76 +192,143 @@ func init() {
 		panic(errors.Wrapf(err, "failed to unmarshal %s", configFile))
 	}
 
+	depFileConfig = configs
+	rememberDepFileEntries(configs)
+
+	enforcePolicy(configs)
+
 	buildBinDep(configs.Bin)
 
 	buildLibDep(configs.Lib)
 
 	buildGoDep(configs.Go)
+
+	buildImageDep(configs.Image)
 }
 
-func buildBinDep(binConfigs map[string]binConfig) {
+func buildBinDep(binConfigs map[string]BinSpec) {
 	for name, bin := range binConfigs { //nolint:gocritic // TODO refactor
-		options := []Option{}
-
-		if len(bin.ZipPaths) != 0 {
-			zipPaths := parseArrayTemplate(bin.ZipPaths, bin.Version)
-			options = append(options, WithZipPaths(zipPaths...))
-		}
-		if len(bin.TGzPaths) != 0 {
-			tgzPaths := parseArrayTemplate(bin.TGzPaths, bin.Version)
-			options = append(options, WithTGzPaths(tgzPaths...))
-		}
-		if len(bin.TXzPaths) != 0 {
-			txzPaths := parseArrayTemplate(bin.TXzPaths, bin.Version)
-			options = append(options, WithTXzPaths(txzPaths...))
+		if err := defBinSpec(name, bin); err != nil {
+			panic(err)
 		}
+	}
+}
+
+func defBinSpec(name string, bin BinSpec) error { //nolint:gocritic // specs are passed by value like in the Depfile
+	options := []Option{}
+
+	if len(bin.ZipPaths) != 0 {
+		zipPaths := parseArrayTemplate(bin.ZipPaths, bin.Version)
+		options = append(options, WithZipPaths(zipPaths...))
+	}
+	if len(bin.TGzPaths) != 0 {
+		tgzPaths := parseArrayTemplate(bin.TGzPaths, bin.Version)
+		options = append(options, WithTGzPaths(tgzPaths...))
+	}
+	if len(bin.TXzPaths) != 0 {
+		txzPaths := parseArrayTemplate(bin.TXzPaths, bin.Version)
+		options = append(options, WithTXzPaths(txzPaths...))
+	}
+	if bin.Format != "" {
+		options = append(options, WithFormat(bin.Format))
+	}
+	if len(bin.Headers) != 0 {
+		options = append(options, WithHeaders(bin.Headers))
+	}
 
-		sha, ok := bin.SHA[runtime.GOOS+"-"+runtime.GOARCH]
-		if !ok {
-			panic(errors.Errorf("no SHA found for os and arch '%s'", runtime.GOOS+"-"+runtime.GOARCH))
+	if len(bin.Entrypoints) != 0 {
+		entrypoints := map[string]string{}
+		for entry, file := range bin.Entrypoints {
+			entrypoints[entry] = parseStringTemplate(file, bin.Version)
 		}
-		entrypoint := parseStringTemplate(bin.Entrypoint, bin.Version)
-		if bin.Entrypoint == "" {
-			entrypoint = name
+		options = append(options, WithEntrypoints(entrypoints))
+	}
+	if len(bin.PostInstall) != 0 {
+		options = append(options, WithPostInstall(parseArrayTemplate(bin.PostInstall, bin.Version)...))
+	}
+	if bin.VersionCheck != nil {
+		args := bin.VersionCheck.Args
+		if args == nil {
+			args = bin.Probe
 		}
-		url := parseStringTemplate(bin.URL, bin.Version)
-		DefBinDep(name, url, bin.Version, sha, entrypoint, options...)
+		options = append(options, WithVersionCheck(args, bin.VersionCheck.Regex))
 	}
+
+	sha, ok := bin.SHA[platform()]
+	if !ok {
+		return errors.Errorf("no SHA found for bin '%s' and os and arch '%s'", name, platform())
+	}
+	entrypoint := parseStringTemplate(bin.Entrypoint, bin.Version)
+	if bin.Entrypoint == "" {
+		entrypoint = name
+	}
+	url := parseStringTemplate(bin.URL, bin.Version)
+	DefBinDep(name, url, bin.Version, sha, entrypoint, options...)
+
+	return nil
 }
 
-func buildLibDep(libConfigs map[string]libConfig) {
+func buildLibDep(libConfigs map[string]LibSpec) {
 	for name, lib := range libConfigs { //nolint:gocritic // TODO refactor
-		options := []Option{}
-		if len(lib.ZipPaths) != 0 {
-			zipPaths := parseArrayTemplate(lib.ZipPaths, lib.Version)
-			options = append(options, WithZipPaths(zipPaths...))
-		}
-		if len(lib.TGzPaths) != 0 {
-			tgzPaths := parseArrayTemplate(lib.TGzPaths, lib.Version)
-			options = append(options, WithTGzPaths(tgzPaths...))
-		}
-		if len(lib.TXzPaths) != 0 {
-			txzPaths := parseArrayTemplate(lib.TXzPaths, lib.Version)
-			options = append(options, WithTGzPaths(txzPaths...))
-		}
+		defLibSpec(name, lib)
+	}
+}
 
-		if lib.LibPrefix != "" {
-			libPrefix := parseStringTemplate(lib.LibPrefix, lib.Version)
-			options = append(options, WithLibPrefix(libPrefix))
-		}
+func defLibSpec(name string, lib LibSpec) { //nolint:gocritic // specs are passed by value like in the Depfile
+	options := []Option{}
+	if len(lib.ZipPaths) != 0 {
+		zipPaths := parseArrayTemplate(lib.ZipPaths, lib.Version)
+		options = append(options, WithZipPaths(zipPaths...))
+	}
+	if len(lib.TGzPaths) != 0 {
+		tgzPaths := parseArrayTemplate(lib.TGzPaths, lib.Version)
+		options = append(options, WithTGzPaths(tgzPaths...))
+	}
+	if len(lib.TXzPaths) != 0 {
+		txzPaths := parseArrayTemplate(lib.TXzPaths, lib.Version)
+		options = append(options, WithTXzPaths(txzPaths...))
+	}
+	if lib.Format != "" {
+		options = append(options, WithFormat(lib.Format))
+	}
+	if len(lib.Headers) != 0 {
+		options = append(options, WithHeaders(lib.Headers))
+	}
 
-		url := parseStringTemplate(lib.URL, lib.Version)
+	if lib.LibPrefix != "" {
+		libPrefix := parseStringTemplate(lib.LibPrefix, lib.Version)
+		options = append(options, WithLibPrefix(libPrefix))
+	}
 
+	switch {
+	case lib.Git != nil:
+		if len(lib.Git.Paths) != 0 {
+			options = append(options, WithGitPaths(parseArrayTemplate(lib.Git.Paths, lib.Version)...))
+		}
+		ref := parseStringTemplate(lib.Git.Ref, lib.Version)
+		DefGitLibDep(name, lib.Git.Repo, ref, lib.OutputDir, options...)
+	case lib.Path != "":
+		dir := lib.Path
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(currentDir, dir)
+		}
+		DefPathLibDep(name, dir, lib.OutputDir)
+	default:
+		url := parseStringTemplate(lib.URL, lib.Version)
 		DefLibDep(name, url, lib.SHA, lib.OutputDir, options...)
 	}
 }
 
-func buildGoDep(goConfigs map[string]goConfig) {
+func buildGoDep(goConfigs map[string]GoSpec) {
 	for name, goBin := range goConfigs {
-		entrypoint := parseStringTemplate(goBin.Entrypoint, goBin.Version)
-		if goBin.Entrypoint == "" {
-			entrypoint = name
-		}
-		DefGoDep(name, goBin.ImportPath, goBin.Version, entrypoint)
+		defGoSpec(name, goBin)
+	}
+}
+
+func defGoSpec(name string, goBin GoSpec) {
+	entrypoint := parseStringTemplate(goBin.Entrypoint, goBin.Version)
+	if goBin.Entrypoint == "" {
+		entrypoint = name
 	}
+	DefGoDep(name, goBin.ImportPath, goBin.Version, entrypoint)
 }
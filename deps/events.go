@@ -0,0 +1,191 @@
+package deps
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	kindBin   = "bin"
+	kindGo    = "go"
+	kindLib   = "lib"
+	kindImage = "image"
+
+	// progressInterval is the minimum time between two download progress events.
+	progressInterval = 250 * time.Millisecond
+)
+
+// Event describes a step in procuring a dependency.
+type Event struct {
+	// Kind is the kind of dependency: bin, go, lib or image.
+	Kind string
+	// Name is the name of the dependency, as defined in the Depfile.
+	Name string
+	// URL is the location the dependency is downloaded from, if any.
+	URL string
+	// Path is the local file or directory the step operates on.
+	Path string
+	// Bytes is the number of bytes processed so far by the step.
+	Bytes int64
+	// TotalBytes is the expected size of a download, or -1 if it's unknown.
+	TotalBytes int64
+	// Duration is the time the step took, or has taken so far.
+	Duration time.Duration
+}
+
+// Listener is notified about the progress of procuring dependencies.
+// Embed NopListener to only implement the events you're interested in.
+type Listener interface {
+	// OnDownloadStart is called once the server responded and the download begins.
+	OnDownloadStart(e Event)
+	// OnDownloadProgress is called periodically while a download is in progress.
+	OnDownloadProgress(e Event)
+	// OnDownloadDone is called when a download completed.
+	OnDownloadDone(e Event)
+	// OnVerify is called after the SHA256 of a download was checked.
+	OnVerify(e Event)
+	// OnExtract is called after an archive was unpacked.
+	OnExtract(e Event)
+	// OnCacheHit is called when a dependency is already procured and nothing needs to be done.
+	OnCacheHit(e Event)
+}
+
+// NopListener is a Listener that ignores all events.
+type NopListener struct{}
+
+func (NopListener) OnDownloadStart(Event)    {}
+func (NopListener) OnDownloadProgress(Event) {}
+func (NopListener) OnDownloadDone(Event)     {}
+func (NopListener) OnVerify(Event)           {}
+func (NopListener) OnExtract(Event)          {}
+func (NopListener) OnCacheHit(Event)         {}
+
+var (
+	listenersMutex = &sync.RWMutex{}
+	listeners      = defaultListeners()
+)
+
+func defaultListeners() []Listener {
+	if strings.EqualFold(os.Getenv("DEPFILE_OUTPUT"), "json") {
+		return []Listener{NewJSONListener(os.Stderr)}
+	}
+
+	return []Listener{uiListener{}}
+}
+
+// SetListener replaces all listeners with the given one.
+// Use NopListener{} to silence procurement output.
+func SetListener(l Listener) {
+	listenersMutex.Lock()
+	defer listenersMutex.Unlock()
+
+	listeners = []Listener{l}
+}
+
+// AddListener adds a listener that is notified in addition to the existing ones.
+func AddListener(l Listener) {
+	listenersMutex.Lock()
+	defer listenersMutex.Unlock()
+
+	listeners = append(listeners, l)
+}
+
+func emit(notify func(Listener)) {
+	listenersMutex.RLock()
+	defer listenersMutex.RUnlock()
+
+	for _, l := range listeners {
+		notify(l)
+	}
+}
+
+// uiListener prints procurement progress to the console.
+type uiListener struct {
+	NopListener
+}
+
+func (uiListener) OnDownloadStart(e Event) {
+	ui.Note().WithStringValue(e.Kind, e.Name).WithStringValue("url", e.URL).Msg("Downloading ...")
+}
+
+func (uiListener) OnVerify(e Event) {
+	ui.Note().WithStringValue(e.Kind, e.Name).Msg("Checking signature ...")
+}
+
+// JSONListener writes every event as a JSON object on its own line.
+type JSONListener struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONListener creates a listener that writes events to w as JSON lines.
+// Setting the DEPFILE_OUTPUT env var to 'json' installs one writing to stderr.
+func NewJSONListener(w io.Writer) *JSONListener {
+	return &JSONListener{enc: json.NewEncoder(w)}
+}
+
+// jsonEvent is an Event written as a JSON line. The event is named after the listener method,
+// and the kind is bin, go, lib or image.
+type jsonEvent struct {
+	Event      string    `json:"event"`
+	Time       time.Time `json:"time"`
+	Kind       string    `json:"kind"`
+	Name       string    `json:"name"`
+	URL        string    `json:"url,omitempty"`
+	Path       string    `json:"path,omitempty"`
+	Bytes      int64     `json:"bytes"`
+	TotalBytes int64     `json:"totalBytes,omitempty"`
+	DurationMS int64     `json:"durationMs"`
+}
+
+func (l *JSONListener) OnDownloadStart(e Event)    { l.write("download_start", e) }
+func (l *JSONListener) OnDownloadProgress(e Event) { l.write("download_progress", e) }
+func (l *JSONListener) OnDownloadDone(e Event)     { l.write("download_done", e) }
+func (l *JSONListener) OnVerify(e Event)           { l.write("verify", e) }
+func (l *JSONListener) OnExtract(e Event)          { l.write("extract", e) }
+func (l *JSONListener) OnCacheHit(e Event)         { l.write("cache_hit", e) }
+
+func (l *JSONListener) write(name string, e Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	err := l.enc.Encode(jsonEvent{
+		Event:      name,
+		Time:       time.Now().UTC(),
+		Kind:       e.Kind,
+		Name:       e.Name,
+		URL:        e.URL,
+		Path:       e.Path,
+		Bytes:      e.Bytes,
+		TotalBytes: e.TotalBytes,
+		DurationMS: e.Duration.Milliseconds(),
+	})
+	if err != nil {
+		ui.Problem().WithErr(err).Msg("failed to write procurement event")
+	}
+}
+
+// progressWriter counts the bytes written through it and
+// periodically emits download progress events.
+type progressWriter struct {
+	event    Event
+	start    time.Time
+	lastEmit time.Time
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.event.Bytes += int64(len(p))
+
+	if now := time.Now(); now.Sub(w.lastEmit) >= progressInterval {
+		w.lastEmit = now
+		w.event.Duration = now.Sub(w.start)
+		e := w.event
+		emit(func(l Listener) { l.OnDownloadProgress(e) })
+	}
+
+	return len(p), nil
+}
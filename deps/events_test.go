@@ -0,0 +1,85 @@
+package deps_test
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/mage-loot/deps"
+)
+
+func tgz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0700, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+
+	return buf.Bytes()
+}
+
+func TestJSONListener(t *testing.T) {
+	assert := require.New(t)
+	deps.SetCurrentDir(t.TempDir())
+
+	var out bytes.Buffer
+	deps.SetListener(deps.NewJSONListener(&out))
+	defer deps.SetListener(deps.NopListener{})
+
+	archive := tgz(t, map[string]string{"events/bin/events": "#!/bin/sh\necho events\n"})
+	srv, _, sha := binServer(t, archive)
+
+	deps.DefBinDep("events", srv.URL+"/events.tgz", "1.0.0", sha, "events",
+		deps.WithTGzPaths("events/bin/events"),
+	)
+
+	deps.BinPath("events")
+	deps.BinPath("events")
+
+	names := []string{}
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var e struct {
+			Event      string `json:"event"`
+			Kind       string `json:"kind"`
+			Name       string `json:"name"`
+			Bytes      int64  `json:"bytes"`
+			TotalBytes int64  `json:"totalBytes"`
+		}
+		assert.NoError(json.Unmarshal(scanner.Bytes(), &e))
+		assert.Equal("bin", e.Kind)
+		assert.Equal("events", e.Name)
+
+		if e.Event == "download_done" {
+			assert.Equal(int64(len(archive)), e.Bytes)
+			assert.Equal(int64(len(archive)), e.TotalBytes)
+		}
+
+		// Progress is reported periodically, so the number of events depends on timing.
+		if e.Event == "download_progress" && names[len(names)-1] == "download_progress" {
+			continue
+		}
+		names = append(names, e.Event)
+	}
+
+	assert.Equal([]string{
+		"download_start",
+		"download_progress",
+		"download_done",
+		"verify",
+		"extract",
+		"cache_hit",
+	}, names)
+}
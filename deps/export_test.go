@@ -0,0 +1,77 @@
+package deps
+
+import (
+	"regexp"
+	"runtime"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// SetCurrentDir points the .ext dir at the given directory, for tests.
+func SetCurrentDir(dir string) {
+	currentDir = dir
+}
+
+// SetDepfile replaces the parsed Depfile with the given content, for tests.
+func SetDepfile(content string) error {
+	cfg := &depFile{}
+	if err := yaml.Unmarshal([]byte(content), cfg); err != nil {
+		return err
+	}
+
+	depFileConfig = cfg
+	depFileEntries = map[string]bool{}
+	rememberDepFileEntries(cfg)
+	return nil
+}
+
+// SetPlatform simulates procuring dependencies for another OS and architecture, for tests.
+// It returns a function that restores the real platform.
+func SetPlatform(os, arch string) func() {
+	goos, goarch = os, arch
+
+	return func() {
+		goos, goarch = runtime.GOOS, runtime.GOARCH
+	}
+}
+
+// LockDep takes the lock guarding the procurement of a dependency, for tests.
+// It returns a function that releases it.
+func LockDep(kind, id string) func() {
+	return lockDep(kind, id)
+}
+
+// DepStatus returns the procurement state of a Depfile entry, as listed by Status, for tests.
+func DepStatus(kind, name string) (procured bool, sha, runs string) {
+	for _, s := range collectStatus(depFileConfig) {
+		if s.kind == kind && s.name == name {
+			return s.procured, s.sha, s.runs
+		}
+	}
+
+	return false, "", ""
+}
+
+// MatchVersion checks the version in the output of a binary, for tests.
+func MatchVersion(out, version, regex string) error {
+	return matchVersion(out, version, regexp.MustCompile(regex))
+}
+
+// SetImagePuller replaces pulling images using the docker CLI and forgets all image dependencies, for tests.
+// It returns a function that restores the docker CLI.
+func SetImagePuller(pull func(image string) ([]string, error)) func() {
+	imagesMutex.Lock()
+	images = map[string]ImageSpec{}
+	imagesMutex.Unlock()
+
+	pullImage = pull
+
+	return func() {
+		pullImage = dockerPull
+	}
+}
+
+// HasDigest checks if one of the repo digests of an image has the given digest, for tests.
+func HasDigest(repoDigests []string, digest string) bool {
+	return hasDigest(repoDigests, digest)
+}
@@ -2,6 +2,7 @@ package deps
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"sync"
 
@@ -22,12 +23,30 @@ func DefGoDep(name, importPath, version, entrypoint string) {
 	binPath := goBinFilePath(name, version)
 
 	config.Go[name].Procure = func() {
+		if isProcured(binPath) {
+			cacheHit(kindGo, name, binPath)
+			return
+		}
+
 		config.Go[name].Once.Do(func() {
-			installGoBin(binPath, importPath, version)
+			unlock := lockDep(kindGo, filepath.Base(binPath))
+			defer unlock()
+
+			// Another process may have procured the dependency while we were waiting for the lock.
+			if isProcured(binPath) {
+				return
+			}
+
+			stagingDir := mkTmpDir()
+			defer os.RemoveAll(stagingDir)
+
+			installGoBin(stagingDir, importPath, version)
+
+			commitProcured(stagingDir, binPath)
 		})
 	}
 
-	config.Go[name].Path = filepath.Join(binPath, entrypoint)
+	config.Go[name].Path = filepath.Join(binPath, exeName(entrypoint))
 }
 
 // GoDepOutput returns a command for running a go dependency.
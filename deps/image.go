@@ -0,0 +1,146 @@
+package deps
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/magefile/mage/sh"
+	"github.com/pkg/errors"
+)
+
+// ErrImageDigestMismatch is returned by PullImages when a pulled image doesn't have the Depfile digest.
+var ErrImageDigestMismatch = errors.New("image digest doesn't match the Depfile")
+
+// ImageSpec describes a container image dependency, optionally pinned by digest.
+type ImageSpec struct {
+	Name   string `yaml:"name"`
+	Tag    string `yaml:"tag"`
+	Digest string `yaml:"digest"`
+}
+
+var (
+	imagesMutex = &sync.RWMutex{}
+	images      = map[string]ImageSpec{}
+
+	// pullImage pulls an image and returns its repo digests. It's replaced in tests.
+	pullImage = dockerPull
+)
+
+// DefImageDep defines a container image dependency.
+// The digest (e.g. 'sha256:...') is optional, but pins the image even if the tag moves.
+func DefImageDep(name, image, tag, digest string) {
+	imagesMutex.Lock()
+	defer imagesMutex.Unlock()
+
+	images[name] = ImageSpec{Name: image, Tag: tag, Digest: digest}
+}
+
+// Image returns the reference of an image dependency, to be used with
+// 'docker run' or docker.Run. If the image has a digest, the reference is
+// pinned to it, e.g. 'openapitools/openapi-generator-cli:v7.0.0@sha256:...'.
+func Image(name string) string {
+	imagesMutex.RLock()
+	img, ok := images[name]
+	imagesMutex.RUnlock()
+
+	if !ok {
+		panic(errors.Errorf("didn't find an image dependency named '%s'", name))
+	}
+
+	return img.reference()
+}
+
+// PullImages pulls all image dependencies using the docker CLI and
+// makes sure their tags still point at the digests pinned in the Depfile.
+func PullImages() error {
+	imagesMutex.RLock()
+	specs := make(map[string]ImageSpec, len(images))
+	names := make([]string, 0, len(images))
+	for name, img := range images {
+		specs[name] = img
+		names = append(names, name)
+	}
+	imagesMutex.RUnlock()
+	sort.Strings(names)
+
+	failed := []string{}
+	for _, name := range names {
+		img := specs[name]
+		tagged := img.Name + ":" + img.Tag
+
+		ui.Normal().Msgf("Pulling image '%s'", tagged)
+		digests, err := pullImage(tagged)
+		if err != nil {
+			return errors.Wrapf(err, "failed to pull image '%s'", name)
+		}
+
+		if img.Digest == "" {
+			ui.Exclamation().WithStringValue("digests", strings.Join(digests, ", ")).Msgf("Image '%s' isn't pinned to a digest.", name)
+			continue
+		}
+
+		if !hasDigest(digests, img.Digest) {
+			ui.Problem().
+				WithStringValue("expected", img.Digest).
+				WithStringValue("actual", strings.Join(digests, ", ")).
+				Msgf("Image '%s' doesn't match its digest.", name)
+			failed = append(failed, name)
+		}
+	}
+
+	if len(failed) != 0 {
+		return errors.Wrapf(ErrImageDigestMismatch, "images: %s", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+// dockerPull pulls an image using the docker CLI and returns its repo digests, like 'repo@sha256:...'.
+func dockerPull(image string) ([]string, error) {
+	if err := sh.RunV("docker", "pull", image); err != nil {
+		return nil, err
+	}
+
+	out, err := sh.Output("docker", "image", "inspect", "--format", "{{json .RepoDigests}}", image)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to inspect image '%s'", image)
+	}
+
+	digests := []string{}
+	if err := json.Unmarshal([]byte(out), &digests); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the repo digests of image '%s'", image)
+	}
+
+	return digests, nil
+}
+
+func (i ImageSpec) reference() string {
+	ref := i.Name
+	if i.Tag != "" {
+		ref += ":" + i.Tag
+	}
+	if i.Digest != "" {
+		ref += "@" + i.Digest
+	}
+
+	return ref
+}
+
+// hasDigest returns true if one of the repo digests (like 'repo@sha256:...') has the given digest.
+func hasDigest(repoDigests []string, digest string) bool {
+	for _, rd := range repoDigests {
+		if _, d, ok := strings.Cut(rd, "@"); ok && d == digest {
+			return true
+		}
+	}
+
+	return false
+}
+
+func buildImageDep(imageConfigs map[string]ImageSpec) {
+	for name, img := range imageConfigs {
+		DefImageDep(name, img.Name, img.Tag, img.Digest)
+	}
+}
@@ -0,0 +1,79 @@
+package deps_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/mage-loot/deps"
+)
+
+func TestImageReference(t *testing.T) {
+	assert := require.New(t)
+
+	digest := "sha256:4c3bb4e4d8b2d7e6fd8b7b49d7ea1e01f1e8a8b4bba0aac40b4ba0c1f64d8f6f"
+
+	deps.DefImageDep("openapi-generator", "openapitools/openapi-generator-cli", "v7.0.0", digest)
+	deps.DefImageDep("alpine", "alpine", "3.20", "")
+
+	assert.Equal("openapitools/openapi-generator-cli:v7.0.0@"+digest, deps.Image("openapi-generator"))
+	assert.Equal("alpine:3.20", deps.Image("alpine"))
+	assert.Panics(func() { deps.Image("missing") })
+}
+
+func TestHasDigest(t *testing.T) {
+	digest := "sha256:4c3bb4e4d8b2d7e6fd8b7b49d7ea1e01f1e8a8b4bba0aac40b4ba0c1f64d8f6f"
+
+	tests := []struct {
+		name        string
+		repoDigests []string
+		expected    bool
+	}{
+		{name: "match", repoDigests: []string{"docker.io/library/alpine@" + digest}, expected: true},
+		{name: "one of several", repoDigests: []string{"ghcr.io/alpine@sha256:aaaa", "alpine@" + digest}, expected: true},
+		{name: "other digest", repoDigests: []string{"alpine@sha256:aaaa"}},
+		{name: "no repo", repoDigests: []string{digest}},
+		{name: "none", repoDigests: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, deps.HasDigest(tt.repoDigests, digest))
+		})
+	}
+}
+
+func TestPullImages(t *testing.T) {
+	assert := require.New(t)
+
+	pinned := "sha256:4c3bb4e4d8b2d7e6fd8b7b49d7ea1e01f1e8a8b4bba0aac40b4ba0c1f64d8f6f"
+	moved := "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+	repoDigests := map[string][]string{}
+	pulled := []string{}
+	defer deps.SetImagePuller(func(image string) ([]string, error) {
+		pulled = append(pulled, image)
+		digests, ok := repoDigests[image]
+		if !ok {
+			return nil, errors.New("manifest unknown")
+		}
+		return digests, nil
+	})()
+
+	repoDigests["postgres:16"] = []string{"postgres@" + pinned}
+	repoDigests["alpine:3.20"] = []string{"alpine@" + moved}
+	deps.DefImageDep("postgres", "postgres", "16", pinned)
+	deps.DefImageDep("alpine", "alpine", "3.20", "")
+
+	assert.NoError(deps.PullImages())
+	assert.Equal([]string{"alpine:3.20", "postgres:16"}, pulled)
+
+	repoDigests["postgres:16"] = []string{"postgres@" + moved}
+	err := deps.PullImages()
+	assert.ErrorIs(err, deps.ErrImageDigestMismatch)
+	assert.ErrorContains(err, "postgres")
+
+	deps.DefImageDep("redis", "redis", "7", "")
+	assert.ErrorContains(deps.PullImages(), "manifest unknown")
+}
@@ -2,11 +2,12 @@ package deps
 
 import (
 	"os"
-	"path"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/aserto-dev/mage-loot/fsutil"
+	"github.com/magefile/mage/sh"
 	"github.com/pkg/errors"
 )
 
@@ -21,74 +22,173 @@ func DefLibDep(name, url, sha, outputDir string, options ...Option) {
 
 	var ops depOptions
 
+	config.Lib[name].Path = libOutputPath(outputDir)
+
 	config.Lib[name].Procure = func() {
 		config.Lib[name].Once.Do(func() {
 			for _, o := range options {
 				o(&ops)
 			}
 
-			if len(ops.zipPaths) != 0 && path.Ext(url) == zipExt {
-				downloadZippedLib(name, url, sha, ops.libPrefix, outputDir, ops.zipPaths)
-				return
+			format := archiveFormat(url, ops.format)
+			switch {
+			case len(ops.zipPaths) != 0 && format == FormatZip:
+				downloadLib(name, url, sha, format, ops.libPrefix, outputDir, ops.zipPaths, ops.headers)
+			case len(ops.tgzPaths) != 0 && format == FormatTGz:
+				downloadLib(name, url, sha, format, ops.libPrefix, outputDir, ops.tgzPaths, ops.headers)
+			case len(ops.txzPaths) != 0 && format == FormatTXz:
+				downloadLib(name, url, sha, format, ops.libPrefix, outputDir, ops.txzPaths, ops.headers)
 			}
+		})
+	}
+}
 
-			if len(ops.tgzPaths) != 0 && (path.Ext(url) == tgzExt || path.Ext(url) == gzExt) {
-				downloadTgzLib(name, url, sha, ops.libPrefix, outputDir, ops.tgzPaths)
-				return
+// DefGitLibDep makes sure a lib dependency is cloned from a git repository
+// at the given ref (a commit, tag or branch) and copies the files matching
+// the patterns given using WithGitPaths. It requires a local `git` binary.
+func DefGitLibDep(name, repo, ref, outputDir string, options ...Option) {
+	cmdRegisterMutex.Lock()
+	defer cmdRegisterMutex.Unlock()
+
+	if _, ok := config.Lib[name]; !ok {
+		config.Lib[name] = &depDetails{Once: &sync.Once{}}
+	}
+
+	var ops depOptions
+
+	config.Lib[name].Path = libOutputPath(outputDir)
+
+	config.Lib[name].Procure = func() {
+		config.Lib[name].Once.Do(func() {
+			for _, o := range options {
+				o(&ops)
 			}
+
+			cloneGitLib(name, repo, ref, ops.libPrefix, outputDir, ops.gitPaths)
 		})
 	}
 }
 
-func downloadZippedLib(name, url, sha, prefix, outputDir string, patterns []string) {
-	downloadLib(name, url, sha, "zip", prefix, outputDir, patterns)
+// DefPathLibDep makes sure a lib dependency is synced from a local directory,
+// e.g. a sibling checkout used during development. The directory is copied
+// into the output dir, keeping its base name.
+func DefPathLibDep(name, dir, outputDir string) {
+	cmdRegisterMutex.Lock()
+	defer cmdRegisterMutex.Unlock()
+
+	if _, ok := config.Lib[name]; !ok {
+		config.Lib[name] = &depDetails{Once: &sync.Once{}}
+	}
+
+	config.Lib[name].Path = libOutputPath(outputDir)
+
+	config.Lib[name].Procure = func() {
+		config.Lib[name].Once.Do(func() {
+			libPath := libOutputPath(outputDir)
+
+			ui.Note().WithStringValue("lib", name).WithStringValue("path", dir).Msg("Syncing ...")
+			err := fsutil.Sync([]string{dir}, libPath, true)
+			if err != nil {
+				panic(errors.Wrapf(err, "failed to sync '%s' to '%s'", dir, libPath))
+			}
+		})
+	}
+}
+
+// LibPath returns the path to the output directory of a lib dependency, procuring it if needed.
+func LibPath(name string) string {
+	def := config.Lib[name]
+
+	if def == nil {
+		panic(errors.Errorf("didn't find a lib dependency named '%s'", name))
+	}
+
+	if !skipProcurement {
+		def.Procure()
+	}
+
+	return def.Path
 }
 
-func downloadTgzLib(name, url, sha, prefix, outputDir string, patterns []string) {
-	downloadLib(name, url, sha, "tgz", prefix, outputDir, patterns)
+func libOutputPath(outputDir string) string {
+	if outputDir == "" {
+		return LibDir()
+	}
+
+	return filepath.Join(LibDir(), outputDir)
 }
 
-func downloadLib(name, url, sha, extension, prefix, outputDir string, patterns []string) {
+func downloadLib(name, url, sha, extension, prefix, outputDir string, patterns []string, headers map[string]string) {
 	filePath := tmpFile(name + "." + extension)
 	defer os.RemoveAll(filepath.Dir(filePath))
 
-	ui.Note().WithStringValue(extension, name).WithStringValue("url", url).Msg("Downloading ...")
-	err := downloadFile(filePath, url)
+	err := downloadFile(kindLib, name, filePath, url, headers)
 	if err != nil {
 		panic(errors.Wrap(err, "failed to download file"))
 	}
 
-	ui.Note().WithStringValue(extension, name).Msg("Checking signature ...")
-	verifyFile(filePath, sha)
+	verifyFile(kindLib, name, filePath, sha)
+
+	unpackDir := mkTmpDir()
+	defer os.RemoveAll(unpackDir)
+
+	err = extractArchive(kindLib, name, extension, filePath, unpackDir)
+
+	if err != nil {
+		panic(errors.Wrapf(err, "failed to unpack '%s'", filePath))
+	}
+
+	installLibFiles(unpackDir, prefix, libOutputPath(outputDir), patterns)
+}
+
+func cloneGitLib(name, repo, ref, prefix, outputDir string, patterns []string) {
+	cloneDir := mkTmpDir()
+	defer os.RemoveAll(cloneDir)
+
+	start := time.Now()
+	startEvent := Event{Kind: kindLib, Name: name, URL: repo, Path: cloneDir, TotalBytes: -1}
+	emit(func(l Listener) { l.OnDownloadStart(startEvent) })
 
-	libPath := LibDir()
-	if outputDir != "" {
-		libPath = filepath.Join(libPath, outputDir)
+	// Only the ref is fetched, without history, as repos like googleapis are large.
+	err := sh.Run("git", "init", "--quiet", cloneDir)
+	if err != nil {
+		panic(errors.Wrapf(err, "failed to init '%s'", cloneDir))
 	}
 
-	err = os.MkdirAll(libPath, 0700)
+	err = sh.Run("git", "-C", cloneDir, "fetch", "--quiet", "--depth", "1", repo, ref)
 	if err != nil {
-		panic(errors.Wrapf(err, "failed to create directory '%s'", libPath))
+		panic(errors.Wrapf(err, "failed to fetch '%s' of '%s'", ref, repo))
 	}
 
-	unpackDir := mkTmpDir()
-	defer os.RemoveAll(unpackDir)
+	err = sh.Run("git", "-C", cloneDir, "checkout", "--quiet", "--detach", "FETCH_HEAD")
+	if err != nil {
+		panic(errors.Wrapf(err, "failed to checkout '%s' of '%s'", ref, repo))
+	}
 
-	err = fsutil.Extract(extension, filePath, unpackDir)
+	size, _ := dirSize(cloneDir)
+	doneEvent := Event{Kind: kindLib, Name: name, URL: repo, Path: cloneDir, Bytes: size, TotalBytes: -1, Duration: time.Since(start)}
+	emit(func(l Listener) { l.OnDownloadDone(doneEvent) })
 
+	installLibFiles(cloneDir, prefix, libOutputPath(outputDir), patterns)
+}
+
+// installLibFiles moves the files in srcDir that match the patterns to libPath,
+// keeping their path relative to srcDir, without the prefix.
+func installLibFiles(srcDir, prefix, libPath string, patterns []string) {
+	err := os.MkdirAll(libPath, 0700)
 	if err != nil {
-		panic(errors.Wrapf(err, "failed to unpack '%s'", filePath))
+		panic(errors.Wrapf(err, "failed to create directory '%s'", libPath))
 	}
 
 	for _, pattern := range patterns {
-		matches, err := filepath.Glob(filepath.Join(unpackDir, pattern))
+		matches, err := filepath.Glob(filepath.Join(srcDir, pattern))
 		if err != nil {
 			panic(errors.Wrapf(err, "failed to glob using pattern '%s'", pattern))
 		}
 
 		for _, m := range matches {
 			ui.Note().WithStringValue("  match", m).Msg("> lib file")
-			relPath, err := filepath.Rel(unpackDir, m)
+			relPath, err := filepath.Rel(srcDir, m)
 			if err != nil {
 				panic(errors.Wrapf(err, "failed to get relative path for '%s'", m))
 			}
@@ -0,0 +1,94 @@
+package deps_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/mage-loot/deps"
+)
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	return string(out)
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+}
+
+func TestGitLibDep(t *testing.T) {
+	assert := require.New(t)
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	deps.SetCurrentDir(t.TempDir())
+
+	// Create a bare repo with two commits, so we can pin the first one.
+	work := t.TempDir()
+	bare := filepath.Join(t.TempDir(), "protos.git")
+	git(t, work, "init", "--quiet")
+	writeFile(t, filepath.Join(work, "protos", "google", "api", "http.proto"), "v1")
+	writeFile(t, filepath.Join(work, "README.md"), "readme")
+	git(t, work, "add", ".")
+	git(t, work, "commit", "--quiet", "-m", "first")
+	ref := strings.TrimSpace(git(t, work, "rev-parse", "HEAD"))
+	git(t, work, "tag", "v1")
+	writeFile(t, filepath.Join(work, "protos", "google", "api", "http.proto"), "v2")
+	git(t, work, "commit", "--quiet", "-am", "second")
+	git(t, t.TempDir(), "clone", "--quiet", "--bare", work, bare)
+
+	deps.DefGitLibDep("googleapis", bare, ref, "googleapis",
+		deps.WithGitPaths("protos/google/api/*.proto"),
+		deps.WithLibPrefix("protos"),
+	)
+
+	libPath := deps.LibPath("googleapis")
+	assert.Equal(filepath.Join(deps.LibDir(), "googleapis"), libPath)
+
+	content, err := os.ReadFile(filepath.Join(libPath, "google", "api", "http.proto"))
+	assert.NoError(err)
+	assert.Equal("v1", string(content))
+
+	assert.NoFileExists(filepath.Join(libPath, "README.md"))
+
+	// Tags are fetched like commits.
+	deps.DefGitLibDep("googleapis-tag", bare, "v1", "googleapis-tag",
+		deps.WithGitPaths("protos/google/api/*.proto"),
+		deps.WithLibPrefix("protos"),
+	)
+
+	content, err = os.ReadFile(filepath.Join(deps.LibPath("googleapis-tag"), "google", "api", "http.proto"))
+	assert.NoError(err)
+	assert.Equal("v1", string(content))
+}
+
+func TestPathLibDep(t *testing.T) {
+	assert := require.New(t)
+
+	deps.SetCurrentDir(t.TempDir())
+
+	src := filepath.Join(t.TempDir(), "options")
+	writeFile(t, filepath.Join(src, "annotations.proto"), "annotations")
+
+	deps.DefPathLibDep("options", src, "grpc-gateway")
+
+	content, err := os.ReadFile(filepath.Join(deps.LibPath("options"), "options", "annotations.proto"))
+	assert.NoError(err)
+	assert.Equal("annotations", string(content))
+}
@@ -0,0 +1,40 @@
+package deps
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/aserto-dev/mage-loot/fsutil"
+	"github.com/pkg/errors"
+)
+
+const (
+	locksDir = "locks"
+)
+
+// lockDep takes an exclusive lock for procuring the dependency of the given kind identified by id.
+// The lock is held on a file under .ext/locks, so it also guards against other
+// processes procuring the same dependency in the same workspace.
+// It blocks until the lock is acquired and returns a function that releases it.
+func lockDep(kind, id string) func() {
+	dir := filepath.Join(currentDir, externalDir, locksDir)
+	fsutil.EnsureDir(dir)
+
+	lockPath := filepath.Join(dir, kind+"-"+id+".lock")
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		panic(errors.Wrapf(err, "failed to open lock file '%s'", lockPath))
+	}
+
+	if err := lockFile(f); err != nil {
+		f.Close()
+		panic(errors.Wrapf(err, "failed to lock '%s'", lockPath))
+	}
+
+	return func() {
+		if err := unlockFile(f); err != nil {
+			ui.Problem().WithErr(err).Msgf("failed to unlock '%s'", lockPath)
+		}
+		f.Close()
+	}
+}
@@ -0,0 +1,34 @@
+//go:build !(darwin || dragonfly || freebsd || illumos || linux || netbsd || openbsd || windows)
+
+package deps
+
+import (
+	"os"
+	"time"
+)
+
+// lockPollInterval is how often lockFile retries on platforms without file locks.
+const lockPollInterval = 100 * time.Millisecond
+
+// heldSuffix is added to the name of a lock file for the file that marks it as held.
+// Platforms without flock create it exclusively, so a lock left by a killed process
+// has to be removed by hand.
+const heldSuffix = ".held"
+
+func lockFile(f *os.File) error {
+	for {
+		held, err := os.OpenFile(f.Name()+heldSuffix, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			return held.Close()
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+
+		time.Sleep(lockPollInterval)
+	}
+}
+
+func unlockFile(f *os.File) error {
+	return os.Remove(f.Name() + heldSuffix)
+}
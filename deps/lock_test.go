@@ -0,0 +1,132 @@
+package deps_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/mage-loot/deps"
+)
+
+// binServer serves content and counts the downloads.
+func binServer(t *testing.T, content []byte) (*httptest.Server, *int32, string) {
+	t.Helper()
+
+	downloads := new(int32)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(downloads, 1)
+		_, _ = w.Write(content)
+	}))
+	t.Cleanup(srv.Close)
+
+	sum := sha256.Sum256(content)
+
+	return srv, downloads, hex.EncodeToString(sum[:])
+}
+
+func TestProcuredMarker(t *testing.T) {
+	assert := require.New(t)
+	deps.SetListener(deps.NopListener{})
+	deps.SetCurrentDir(t.TempDir())
+
+	content := []byte("#!/bin/sh\necho marker\n")
+	srv, downloads, sha := binServer(t, content)
+
+	deps.DefBinDep("marker", srv.URL+"/marker", "1.0.0", sha, "marker")
+
+	binPath := deps.BinPath("marker")
+	assert.FileExists(binPath)
+	assert.FileExists(filepath.Join(filepath.Dir(binPath), ".procured"))
+
+	entries, err := os.ReadDir(deps.ExtTmpDir())
+	assert.NoError(err)
+	assert.Empty(entries, "the staging dir should be moved into place")
+
+	deps.BinPath("marker")
+	assert.Equal(int32(1), atomic.LoadInt32(downloads))
+}
+
+func TestInterruptedProcurement(t *testing.T) {
+	assert := require.New(t)
+	deps.SetListener(deps.NopListener{})
+	deps.SetCurrentDir(t.TempDir())
+
+	content := []byte("#!/bin/sh\necho interrupted\n")
+	srv, downloads, sha := binServer(t, content)
+
+	// A previous procurement was interrupted after the binary was partially written,
+	// leaving a dir without a marker.
+	binDir := filepath.Join(deps.BinDir(), "interrupted-1.0.0")
+	writeFile(t, filepath.Join(binDir, "interrupted"), "#!/bin/sh\n")
+
+	deps.DefBinDep("interrupted", srv.URL+"/interrupted", "1.0.0", sha, "interrupted")
+
+	installed, err := os.ReadFile(deps.BinPath("interrupted"))
+	assert.NoError(err)
+	assert.Equal(content, installed)
+	assert.Equal(int32(1), atomic.LoadInt32(downloads))
+	assert.FileExists(filepath.Join(binDir, ".procured"))
+}
+
+func TestConcurrentProcurement(t *testing.T) {
+	assert := require.New(t)
+	deps.SetListener(deps.NopListener{})
+	deps.SetCurrentDir(t.TempDir())
+
+	content := []byte("#!/bin/sh\necho concurrent\n")
+	srv, downloads, sha := binServer(t, content)
+
+	deps.DefBinDep("concurrent", srv.URL+"/concurrent", "1.0.0", sha, "concurrent")
+
+	// Another process is procuring the same dependency.
+	unlock := deps.LockDep("bin", "concurrent-1.0.0")
+
+	done := make(chan string)
+	go func() {
+		done <- deps.BinPath("concurrent")
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("procurement didn't wait for the lock")
+	case <-time.After(200 * time.Millisecond):
+	}
+	assert.Equal(int32(0), atomic.LoadInt32(downloads))
+
+	unlock()
+
+	binPath := <-done
+	installed, err := os.ReadFile(binPath)
+	assert.NoError(err)
+	assert.Equal(content, installed)
+	assert.Equal(int32(1), atomic.LoadInt32(downloads))
+}
+
+func TestLockDepKinds(t *testing.T) {
+	deps.SetCurrentDir(t.TempDir())
+
+	// A bin and a go dep with the same name and version don't share a lock.
+	unlockBin := deps.LockDep("bin", "tool-1.0.0")
+	defer unlockBin()
+
+	locked := make(chan struct{})
+	go func() {
+		unlockGo := deps.LockDep("go", "tool-1.0.0")
+		defer unlockGo()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the go dep waited for the lock of the bin dep")
+	}
+}
@@ -0,0 +1,131 @@
+package deps
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aserto-dev/mage-loot/fsutil"
+	"github.com/pkg/errors"
+)
+
+const (
+	procuredMarker = ".procured"
+)
+
+// manifest is stored in the completion marker of a procured dependency.
+// It records the SHA256 of every installed file, so installations can be verified later.
+type manifest struct {
+	Procured time.Time         `json:"procured"`
+	Files    map[string]string `json:"files"`
+}
+
+// isProcured returns true if dir holds a dependency that was completely procured.
+// A dir without a completion marker is left over from an interrupted procurement.
+func isProcured(dir string) bool {
+	exists, err := fsutil.FileExists(filepath.Join(dir, procuredMarker))
+	if err != nil {
+		panic(errors.Wrapf(err, "failed to determine if '%s' is procured", dir))
+	}
+
+	return exists
+}
+
+// commitProcured marks the staging dir as complete and atomically moves it to dir,
+// replacing anything left over from a previous, interrupted procurement.
+func commitProcured(stagingDir, dir string) {
+	files, err := hashDir(stagingDir)
+	if err != nil {
+		panic(errors.Wrapf(err, "failed to calculate sha of files in '%s'", stagingDir))
+	}
+
+	content, err := json.MarshalIndent(manifest{Procured: time.Now().UTC(), Files: files}, "", "  ")
+	if err != nil {
+		panic(errors.Wrap(err, "failed to marshal manifest"))
+	}
+
+	marker := filepath.Join(stagingDir, procuredMarker)
+	err = os.WriteFile(marker, content, 0600)
+	if err != nil {
+		panic(errors.Wrapf(err, "failed to write marker '%s'", marker))
+	}
+
+	err = os.RemoveAll(dir)
+	if err != nil {
+		panic(errors.Wrapf(err, "failed to remove incomplete dir '%s'", dir))
+	}
+
+	err = os.MkdirAll(filepath.Dir(dir), 0700)
+	if err != nil {
+		panic(errors.Wrapf(err, "failed to create directory '%s'", filepath.Dir(dir)))
+	}
+
+	err = os.Rename(stagingDir, dir)
+	if err != nil {
+		panic(errors.Wrapf(err, "failed to move '%s' to '%s'", stagingDir, dir))
+	}
+}
+
+// readManifest loads the manifest of a procured dependency.
+func readManifest(dir string) (*manifest, error) {
+	content, err := os.ReadFile(filepath.Join(dir, procuredMarker))
+	if err != nil {
+		return nil, err
+	}
+
+	m := &manifest{}
+	if err := json.Unmarshal(content, m); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse manifest of '%s'", dir)
+	}
+
+	return m, nil
+}
+
+// hashDir calculates the SHA256 of all regular files in dir, keyed by their slash separated relative path.
+func hashDir(dir string) (map[string]string, error) {
+	files := map[string]string{}
+
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || d.Name() == procuredMarker {
+			return nil
+		}
+
+		sum, err := hashFile(p)
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = sum
+
+		return nil
+	})
+
+	return files, err
+}
+
+func hashFile(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
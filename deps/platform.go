@@ -0,0 +1,32 @@
+package deps
+
+import (
+	"runtime"
+	"strings"
+)
+
+const (
+	osWindows = "windows"
+	exeExt    = ".exe"
+)
+
+// goos and goarch are the platform dependencies are procured for.
+// They're only changed by tests, to simulate other platforms.
+var (
+	goos   = runtime.GOOS
+	goarch = runtime.GOARCH
+)
+
+// platform returns the key of the current platform in a bin's SHA map, like 'linux-amd64'.
+func platform() string {
+	return goos + "-" + goarch
+}
+
+// exeName adds the '.exe' extension to the name of an executable on Windows, unless it already has it.
+func exeName(name string) string {
+	if goos != osWindows || strings.HasSuffix(strings.ToLower(name), exeExt) {
+		return name
+	}
+
+	return name + exeExt
+}
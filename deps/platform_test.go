@@ -0,0 +1,88 @@
+package deps_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/mage-loot/deps"
+)
+
+func TestWindowsRawBin(t *testing.T) {
+	assert := require.New(t)
+	deps.SetListener(deps.NopListener{})
+	deps.SetCurrentDir(t.TempDir())
+	assert.NoError(deps.SetDepfile(""))
+	defer deps.SetPlatform("windows", "amd64")()
+
+	content := []byte("MZ")
+	srv := serve(t, "/tool-windows-amd64.exe", content)
+
+	assert.NoError(deps.RegisterBin("wintool", deps.BinSpec{
+		URL:     srv.URL + "/tool-{{.OS}}-{{.Arch}}.exe",
+		Version: "1.0.0",
+		SHA:     map[string]string{"windows-amd64": sha(content), "linux-amd64": "aaaa"},
+	}))
+
+	assert.Equal("wintool.exe", filepath.Base(deps.BinPath("wintool")))
+}
+
+func TestWindowsZippedBin(t *testing.T) {
+	assert := require.New(t)
+	deps.SetListener(deps.NopListener{})
+	deps.SetCurrentDir(t.TempDir())
+	assert.NoError(deps.SetDepfile(""))
+	defer deps.SetPlatform("windows", "arm64")()
+
+	// Some Windows tools create zip files with backslash separators.
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for _, name := range []string{`bin\protoc.exe`, `bin\helper.EXE`} {
+		w, err := zw.Create(name)
+		assert.NoError(err)
+		_, err = w.Write([]byte("MZ"))
+		assert.NoError(err)
+	}
+	assert.NoError(zw.Close())
+
+	srv := serve(t, "/protoc-win64.zip", buf.Bytes())
+
+	assert.NoError(deps.RegisterBin("winprotoc", deps.BinSpec{
+		URL:         srv.URL + "/protoc-win64.zip",
+		Version:     "1.0.0",
+		Entrypoint:  "protoc",
+		Entrypoints: map[string]string{"helper": "helper.EXE"},
+		ZipPaths:    []string{"bin/*"},
+		SHA:         map[string]string{"windows-arm64": sha(buf.Bytes())},
+	}))
+
+	assert.Equal("protoc.exe", filepath.Base(deps.BinPath("winprotoc")))
+	assert.Equal("helper.EXE", filepath.Base(deps.BinPath("winprotoc:helper")))
+}
+
+func serve(t *testing.T, path string, content []byte) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(content)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func sha(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,262 @@
+package deps
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aserto-dev/mage-loot/fsutil"
+	"github.com/aserto-dev/mage-loot/semver"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	policyFileName = "Depfile.policy"
+	defaultHost    = "docker.io"
+)
+
+var ErrPolicyViolation = errors.New("Depfile violates policy")
+
+// policy holds rules that all Depfile entries must follow.
+type policy struct {
+	// Enforce makes loading the Depfile fail if it violates the policy.
+	Enforce bool `yaml:"enforce"`
+	// AllowedHosts are the hosts dependencies can be downloaded from.
+	// A leading '*.' allows all subdomains.
+	AllowedHosts []string `yaml:"allowedHosts"`
+	// RequiredPlatforms are the platforms (like 'linux-amd64') every bin must have a SHA for.
+	RequiredPlatforms []string `yaml:"requiredPlatforms"`
+	// RequireDigests requires every image to be pinned to a digest.
+	RequireDigests bool `yaml:"requireDigests"`
+	// Banned lists versions that can't be used, by dependency name.
+	Banned map[string][]string `yaml:"banned"`
+	// MinVersions are the lowest versions that can be used, by dependency name.
+	MinVersions map[string]string `yaml:"minVersions"`
+}
+
+type violation struct {
+	kind    string
+	name    string
+	rule    string
+	message string
+}
+
+// Policy evaluates the Depfile against the policy file and prints a report.
+// The policy is read from a 'Depfile.policy' file next to the Depfile,
+// or from the path in the DEPFILE_POLICY env var.
+func Policy() error {
+	if depFileConfig == nil {
+		ui.Exclamation().Msg("No Depfile found.")
+		return nil
+	}
+
+	p, err := loadPolicy()
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		ui.Exclamation().Msg("No Depfile policy found.")
+		return nil
+	}
+
+	return reportViolations(p.evaluate(depFileConfig))
+}
+
+func lookupPolicy() string {
+	if policyPath, ok := os.LookupEnv("DEPFILE_POLICY"); ok {
+		return policyPath
+	}
+
+	policyPath := filepath.Join(currentDir, policyFileName)
+	if exists, _ := fsutil.FileExists(policyPath); exists {
+		return policyPath
+	}
+
+	return ""
+}
+
+func loadPolicy() (*policy, error) {
+	policyPath := lookupPolicy()
+	if policyPath == "" {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(policyPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", policyPath)
+	}
+
+	p := &policy{}
+	if err := yaml.Unmarshal(content, p); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal %s", policyPath)
+	}
+
+	return p, nil
+}
+
+// enforcePolicy is called when the Depfile is loaded, and
+// fails if the policy is enforced and violated.
+func enforcePolicy(cfg *depFile) {
+	p, err := loadPolicy()
+	if err != nil {
+		panic(err)
+	}
+	if p == nil || !p.Enforce {
+		return
+	}
+
+	if err := reportViolations(p.evaluate(cfg)); err != nil {
+		panic(err)
+	}
+}
+
+func reportViolations(violations []violation) error {
+	if len(violations) == 0 {
+		ui.Success().Msg("Depfile complies with the policy.")
+		return nil
+	}
+
+	table := ui.Problem().WithTable("Kind", "Name", "Rule", "Violation")
+	for _, v := range violations {
+		table.WithTableRow(v.kind, v.name, v.rule, v.message)
+	}
+	table.Do()
+
+	return errors.Wrapf(ErrPolicyViolation, "%d violations", len(violations))
+}
+
+func (p *policy) evaluate(cfg *depFile) []violation {
+	violations := []violation{}
+
+	add := func(kind, name, rule, format string, args ...interface{}) {
+		violations = append(violations, violation{kind: kind, name: name, rule: rule, message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, name := range sortedKeys(cfg.Go) {
+		goBin := cfg.Go[name]
+		host, _, _ := strings.Cut(goBin.ImportPath, "/")
+		if !p.hostAllowed(host) {
+			add(kindGo, name, "allowedHosts", "import path '%s' isn't from an allowed host", goBin.ImportPath)
+		}
+		p.checkVersion(kindGo, name, goBin.Version, add)
+	}
+
+	for _, name := range sortedKeys(cfg.Bin) {
+		bin := cfg.Bin[name]
+		for _, required := range p.RequiredPlatforms {
+			if bin.SHA[required] == "" {
+				add(kindBin, name, "requiredPlatforms", "no SHA for '%s'", required)
+			}
+		}
+		for _, target := range sortedKeys(bin.SHA) {
+			targetOS, targetArch, _ := strings.Cut(target, "-")
+			binURL := renderTemplate(bin.URL, bin.Version, targetOS, targetArch)
+			if !p.hostAllowed(urlHost(binURL)) {
+				add(kindBin, name, "allowedHosts", "'%s' isn't from an allowed host", binURL)
+			}
+		}
+		p.checkVersion(kindBin, name, bin.Version, add)
+	}
+
+	for _, name := range sortedKeys(cfg.Lib) {
+		lib := cfg.Lib[name]
+		switch {
+		case lib.Git != nil:
+			if !p.hostAllowed(urlHost(lib.Git.Repo)) {
+				add(kindLib, name, "allowedHosts", "'%s' isn't from an allowed host", lib.Git.Repo)
+			}
+		case lib.Path != "":
+			// Local directories aren't downloaded.
+		default:
+			libURL := parseStringTemplate(lib.URL, lib.Version)
+			if !p.hostAllowed(urlHost(libURL)) {
+				add(kindLib, name, "allowedHosts", "'%s' isn't from an allowed host", libURL)
+			}
+			if len(p.RequiredPlatforms) != 0 && lib.SHA == "" {
+				add(kindLib, name, "requiredPlatforms", "no SHA")
+			}
+		}
+		p.checkVersion(kindLib, name, lib.Version, add)
+	}
+
+	for _, name := range sortedKeys(cfg.Image) {
+		img := cfg.Image[name]
+		if !p.hostAllowed(imageHost(img.Name)) {
+			add(kindImage, name, "allowedHosts", "'%s' isn't from an allowed registry", img.Name)
+		}
+		if p.RequireDigests && img.Digest == "" {
+			add(kindImage, name, "requireDigests", "'%s' isn't pinned to a digest", img.reference())
+		}
+		p.checkVersion(kindImage, name, img.Tag, add)
+	}
+
+	return violations
+}
+
+func (p *policy) checkVersion(kind, name, version string, add func(kind, name, rule, format string, args ...interface{})) {
+	for _, banned := range p.Banned[name] {
+		if strings.TrimPrefix(banned, "v") == strings.TrimPrefix(version, "v") {
+			add(kind, name, "banned", "version '%s' is banned", version)
+		}
+	}
+
+	minVersion, ok := p.MinVersions[name]
+	if !ok {
+		return
+	}
+
+	c, err := semver.Compare(version, minVersion)
+	switch {
+	case err != nil:
+		add(kind, name, "minVersions", "can't compare '%s' with '%s': %s", version, minVersion, err)
+	case c < 0:
+		add(kind, name, "minVersions", "version '%s' is lower than '%s'", version, minVersion)
+	}
+}
+
+// hostAllowed returns true if there are no allowed hosts, or if the host matches one of them.
+func (p *policy) hostAllowed(host string) bool {
+	if len(p.AllowedHosts) == 0 {
+		return true
+	}
+
+	host = strings.ToLower(host)
+	for _, allowed := range p.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(allowed, "*"); ok && strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// urlHost returns the host of a URL, including scp-like git URLs such as 'git@github.com:org/repo.git'.
+func urlHost(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Hostname()
+	}
+
+	if _, rest, ok := strings.Cut(rawURL, "@"); ok {
+		host, _, _ := strings.Cut(rest, ":")
+		return host
+	}
+
+	return ""
+}
+
+// imageHost returns the registry of an image name, which is Docker Hub if it has none.
+func imageHost(name string) string {
+	first, _, ok := strings.Cut(name, "/")
+	if ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return first
+	}
+
+	return defaultHost
+}
@@ -0,0 +1,70 @@
+package deps_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/mage-loot/deps"
+)
+
+const policyDepfile = `
+go:
+  sver:
+    importPath: "github.com/aserto-dev/sver/cmd/sver"
+    version: "v1.3.13"
+bin:
+  buf:
+    url: "https://github.com/bufbuild/buf/releases/download/v{{.Version}}/buf-{{.OS}}-{{.Arch}}"
+    version: "1.28.1"
+    sha:
+      linux-amd64: "aaaa"
+image:
+  alpine:
+    name: "alpine"
+    tag: "3.20"
+`
+
+func writePolicy(t *testing.T, content string) {
+	t.Helper()
+
+	policyPath := filepath.Join(t.TempDir(), "Depfile.policy")
+	require.NoError(t, os.WriteFile(policyPath, []byte(content), 0600))
+	t.Setenv("DEPFILE_POLICY", policyPath)
+}
+
+func TestPolicyCompliant(t *testing.T) {
+	assert := require.New(t)
+	assert.NoError(deps.SetDepfile(policyDepfile))
+
+	writePolicy(t, `
+allowedHosts: ["github.com", "docker.io"]
+requiredPlatforms: ["linux-amd64"]
+minVersions:
+  buf: "1.20.0"
+`)
+
+	assert.NoError(deps.Policy())
+}
+
+func TestPolicyViolations(t *testing.T) {
+	assert := require.New(t)
+	assert.NoError(deps.SetDepfile(policyDepfile))
+
+	writePolicy(t, `
+allowedHosts: ["*.example.com"]
+requiredPlatforms: ["linux-amd64", "darwin-arm64"]
+requireDigests: true
+banned:
+  sver: ["1.3.13"]
+minVersions:
+  buf: "1.30.0"
+`)
+
+	err := deps.Policy()
+	assert.ErrorIs(err, deps.ErrPolicyViolation)
+	// Three disallowed hosts, a missing SHA, a missing digest, a banned and a too low version.
+	assert.ErrorContains(err, "7 violations")
+}
@@ -0,0 +1,77 @@
+package deps
+
+import (
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var ErrVersionMismatch = errors.New("binary doesn't report the expected version")
+
+// runPostInstall runs the post install commands of a binary using the system shell.
+// Commands run from inside dir, which is also prepended to the PATH. dir is the staging dir,
+// which is moved into place once procurement completes, so commands must only use relative paths,
+// e.g. for symlinks. Absolute paths like $PWD point to a directory that won't exist anymore.
+func runPostInstall(name, dir string, commands []string) {
+	for _, command := range commands {
+		ui.Note().WithStringValue("bin", name).WithStringValue("command", command).Msg("Running post install ...")
+
+		shell, flag := "sh", "-c"
+		if goos == osWindows {
+			shell, flag = "cmd", "/C"
+		}
+
+		cmd := exec.Command(shell, flag, command) //nolint:gosec // commands come from the Depfile
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "PATH="+dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+		cmd.Stdout = ui.Output()
+		cmd.Stderr = ui.Err()
+
+		if err := cmd.Run(); err != nil {
+			panic(errors.Wrapf(err, "post install command '%s' of bin '%s' failed", command, name))
+		}
+	}
+}
+
+// checkVersion runs a binary and makes sure the version it reports matches the expected one.
+func checkVersion(binPath, version string, check *VersionCheck) error {
+	re, err := regexp.Compile(check.Regex)
+	if err != nil {
+		return errors.Wrapf(err, "invalid version check regex '%s'", check.Regex)
+	}
+
+	args := check.Args
+	if args == nil {
+		args = defaultProbe
+	}
+
+	out, err := probeBinary(binPath, args...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to run '%s %s': %s", binPath, strings.Join(args, " "), out)
+	}
+
+	return matchVersion(out, version, re)
+}
+
+// matchVersion makes sure the version in the output of a binary equals the expected one, ignoring a leading 'v'.
+// The version is the first group of the regex, or the whole match if it has no groups.
+func matchVersion(out, version string, re *regexp.Regexp) error {
+	match := re.FindStringSubmatch(out)
+	if match == nil {
+		return errors.Wrapf(ErrVersionMismatch, "output '%s' doesn't match '%s'", strings.TrimSpace(out), re)
+	}
+
+	reported := match[0]
+	if len(match) > 1 {
+		reported = match[1]
+	}
+
+	if strings.TrimPrefix(reported, "v") != strings.TrimPrefix(version, "v") {
+		return errors.Wrapf(ErrVersionMismatch, "expected '%s', got '%s'", version, reported)
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package deps_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/mage-loot/deps"
+)
+
+func TestMatchVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		out      string
+		version  string
+		regex    string
+		mismatch bool
+	}{
+		{name: "first group", out: "protoc-gen-grpc-web 1.4.2\n", version: "1.4.2", regex: `(\d+\.\d+\.\d+)`},
+		{name: "whole match without groups", out: "1.4.2\n", version: "1.4.2", regex: `\d+\.\d+\.\d+`},
+		{name: "leading v in output", out: "buf v1.28.1", version: "1.28.1", regex: `v\d+\.\d+\.\d+`},
+		{name: "leading v in version", out: "buf 1.28.1", version: "v1.28.1", regex: `(\d+\.\d+\.\d+)`},
+		{name: "only the first group counts", out: "tool 1.0.0 (go 1.21.0)", version: "1.0.0", regex: `(\d+\.\d+\.\d+) \(go (\d+\.\d+\.\d+)\)`},
+		{name: "other version", out: "tool 1.0.1", version: "1.0.0", regex: `(\d+\.\d+\.\d+)`, mismatch: true},
+		{name: "no match", out: "unknown flag --version", version: "1.0.0", regex: `(\d+\.\d+\.\d+)`, mismatch: true},
+		{name: "optional group didn't match", out: "tool 1.0.0", version: "1.0.0", regex: `tool( v\d+)?`, mismatch: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := deps.MatchVersion(tt.out, tt.version, tt.regex)
+			if tt.mismatch {
+				require.ErrorIs(t, err, deps.ErrVersionMismatch)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package deps
+
+import (
+	"github.com/pkg/errors"
+)
+
+// depFileEntries has the 'kind:name' of every entry in the Depfile,
+// which take precedence over registered dependencies.
+var depFileEntries = map[string]bool{}
+
+// RegisterBin defines a binary dependency from Go code, with the same schema as
+// a 'bin' entry in the Depfile. Libraries can use it to ship default tool versions:
+// if the Depfile has an entry with the same name, it wins and the spec is ignored.
+// Registered dependencies are included in Status, SBOM and Policy.
+func RegisterBin(name string, spec BinSpec) error { //nolint:gocritic // specs are passed by value like in the Depfile
+	if !register(kindBin, name) {
+		return nil
+	}
+
+	if err := defBinSpec(name, spec); err != nil {
+		return err
+	}
+
+	registerSpec(func(cfg *depFile) { cfg.Bin[name] = spec })
+	return nil
+}
+
+// RegisterLib defines a lib dependency from Go code, with the same schema as
+// a 'lib' entry in the Depfile. A Depfile entry with the same name wins.
+func RegisterLib(name string, spec LibSpec) error { //nolint:gocritic // specs are passed by value like in the Depfile
+	if !register(kindLib, name) {
+		return nil
+	}
+
+	if spec.Git == nil && spec.Path == "" && spec.URL == "" {
+		return errors.Errorf("lib '%s' needs a url, git repository or path", name)
+	}
+
+	defLibSpec(name, spec)
+
+	registerSpec(func(cfg *depFile) { cfg.Lib[name] = spec })
+	return nil
+}
+
+// RegisterGo defines a go dependency from Go code, with the same schema as
+// a 'go' entry in the Depfile. A Depfile entry with the same name wins.
+func RegisterGo(name string, spec GoSpec) error {
+	if !register(kindGo, name) {
+		return nil
+	}
+
+	if spec.ImportPath == "" {
+		return errors.Errorf("go dependency '%s' needs an import path", name)
+	}
+
+	defGoSpec(name, spec)
+
+	registerSpec(func(cfg *depFile) { cfg.Go[name] = spec })
+	return nil
+}
+
+// RegisterImage defines an image dependency from Go code, with the same schema as
+// an 'image' entry in the Depfile. A Depfile entry with the same name wins.
+func RegisterImage(name string, spec ImageSpec) error {
+	if !register(kindImage, name) {
+		return nil
+	}
+
+	if spec.Name == "" {
+		return errors.Errorf("image '%s' needs a name", name)
+	}
+
+	DefImageDep(name, spec.Name, spec.Tag, spec.Digest)
+
+	registerSpec(func(cfg *depFile) { cfg.Image[name] = spec })
+	return nil
+}
+
+// register returns false if the dependency is defined in the Depfile.
+func register(kind, name string) bool {
+	cmdRegisterMutex.Lock()
+	defined := depFileEntries[kind+":"+name]
+	cmdRegisterMutex.Unlock()
+
+	if defined {
+		ui.Note().WithStringValue(kind, name).Msg("Using the version from the Depfile.")
+		return false
+	}
+
+	return true
+}
+
+// rememberDepFileEntries records the entries of the Depfile, so they aren't overridden by registration.
+func rememberDepFileEntries(cfg *depFile) {
+	for name := range cfg.Go {
+		depFileEntries[kindGo+":"+name] = true
+	}
+	for name := range cfg.Bin {
+		depFileEntries[kindBin+":"+name] = true
+	}
+	for name := range cfg.Lib {
+		depFileEntries[kindLib+":"+name] = true
+	}
+	for name := range cfg.Image {
+		depFileEntries[kindImage+":"+name] = true
+	}
+}
+
+// registerSpec adds a registered spec to the Depfile config using add.
+// The lock is held across the lookup and the write, as registration can run concurrently using mg.Deps.
+func registerSpec(add func(cfg *depFile)) {
+	cmdRegisterMutex.Lock()
+	defer cmdRegisterMutex.Unlock()
+
+	add(effectiveConfig())
+}
+
+// effectiveConfig returns the Depfile config, with registered dependencies added to it.
+// The caller must hold cmdRegisterMutex.
+func effectiveConfig() *depFile {
+	if depFileConfig == nil {
+		depFileConfig = &depFile{}
+	}
+	if depFileConfig.Go == nil {
+		depFileConfig.Go = map[string]GoSpec{}
+	}
+	if depFileConfig.Bin == nil {
+		depFileConfig.Bin = map[string]BinSpec{}
+	}
+	if depFileConfig.Lib == nil {
+		depFileConfig.Lib = map[string]LibSpec{}
+	}
+	if depFileConfig.Image == nil {
+		depFileConfig.Image = map[string]ImageSpec{}
+	}
+
+	return depFileConfig
+}
@@ -0,0 +1,143 @@
+package deps_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/mage-loot/deps"
+)
+
+const registerDepfile = `
+bin:
+  tool:
+    url: "https://example.com/tool-{{.Version}}"
+    version: "1.0.0"
+    sha:
+      linux-amd64: "aaaa"
+`
+
+func TestRegisterDepfileWins(t *testing.T) {
+	assert := require.New(t)
+	deps.SetListener(deps.NopListener{})
+	assert.NoError(deps.SetDepfile(registerDepfile))
+
+	assert.NoError(deps.RegisterBin("tool", deps.BinSpec{
+		URL:     "https://example.com/tool-{{.Version}}",
+		Version: "2.0.0",
+		SHA:     map[string]string{runtime.GOOS + "-" + runtime.GOARCH: "bbbb"},
+	}))
+	assert.NoError(deps.RegisterImage("postgres", deps.ImageSpec{Name: "postgres", Tag: "16"}))
+
+	out, err := deps.SBOM(deps.SBOMCycloneDX)
+	assert.NoError(err)
+
+	var bom struct {
+		Components []struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"components"`
+	}
+	assert.NoError(json.Unmarshal(out, &bom))
+
+	versions := map[string]string{}
+	for _, c := range bom.Components {
+		versions[c.Name] = c.Version
+	}
+	assert.Equal(map[string]string{"tool": "1.0.0", "postgres": "16"}, versions)
+	assert.Equal("postgres:16", deps.Image("postgres"))
+}
+
+func TestRegisterBinMissingSHA(t *testing.T) {
+	assert := require.New(t)
+	assert.NoError(deps.SetDepfile(""))
+
+	err := deps.RegisterBin("nosha", deps.BinSpec{
+		URL:     "https://example.com/nosha",
+		Version: "1.0.0",
+		SHA:     map[string]string{"plan9-mips": "aaaa"},
+	})
+	assert.ErrorContains(err, "no SHA found for bin 'nosha'")
+}
+
+func TestRegisterBinHeaders(t *testing.T) {
+	assert := require.New(t)
+	deps.SetListener(deps.NopListener{})
+	deps.SetCurrentDir(t.TempDir())
+	assert.NoError(deps.SetDepfile(""))
+	t.Setenv("REGISTER_TEST_TOKEN", "secret")
+
+	content := []byte("#!/bin/sh\necho 1.2.3\n")
+	sum := sha256.Sum256(content)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write(content)
+	}))
+	defer srv.Close()
+
+	assert.NoError(deps.RegisterBin("private", deps.BinSpec{
+		URL:     srv.URL + "/private-{{.Version}}.zip",
+		Version: "1.2.3",
+		Format:  deps.FormatRaw,
+		Headers: map[string]string{"Authorization": "Bearer $REGISTER_TEST_TOKEN"},
+		SHA:     map[string]string{runtime.GOOS + "-" + runtime.GOARCH: hex.EncodeToString(sum[:])},
+	}))
+
+	installed, err := os.ReadFile(deps.BinPath("private"))
+	assert.NoError(err)
+	assert.Equal(content, installed)
+}
+
+func TestRegisterConcurrently(t *testing.T) {
+	assert := require.New(t)
+	deps.SetListener(deps.NopListener{})
+	assert.NoError(deps.SetDepfile(""))
+
+	// mg.Deps runs targets concurrently, and each can register its dependencies.
+	wg := sync.WaitGroup{}
+	errs := make(chan error, 32)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			name := fmt.Sprintf("tool%d", i)
+			errs <- deps.RegisterBin(name, deps.BinSpec{
+				URL:     "https://example.com/" + name,
+				Version: "1.0.0",
+				SHA:     map[string]string{runtime.GOOS + "-" + runtime.GOARCH: "aaaa"},
+			})
+			errs <- deps.RegisterGo(name, deps.GoSpec{ImportPath: "example.com/" + name, Version: "v1.0.0"})
+			errs <- deps.RegisterLib(name, deps.LibSpec{URL: "https://example.com/" + name + ".zip", Version: "1.0.0"})
+			errs <- deps.RegisterImage(name, deps.ImageSpec{Name: name, Tag: "1.0.0"})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(err)
+	}
+
+	out, err := deps.SBOM(deps.SBOMCycloneDX)
+	assert.NoError(err)
+
+	var bom struct {
+		Components []json.RawMessage `json:"components"`
+	}
+	assert.NoError(json.Unmarshal(out, &bom))
+	assert.Len(bom.Components, 32)
+}
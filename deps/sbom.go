@@ -0,0 +1,370 @@
+package deps
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// SBOMCycloneDX is the CycloneDX 1.5 JSON format.
+	SBOMCycloneDX = "cyclonedx"
+	// SBOMSPDX is the SPDX 2.3 JSON format.
+	SBOMSPDX = "spdx"
+
+	sbomToolName = "mage-loot"
+	noAssertion  = "NOASSERTION"
+)
+
+var (
+	ErrUnknownSBOMFormat = errors.New("unknown SBOM format")
+
+	spdxIDInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9.\-]+`)
+)
+
+// sbomArtifact is something downloaded to procure a dependency.
+// Binaries have one artifact per platform, other dependencies have a single one.
+type sbomArtifact struct {
+	platform string
+	url      string
+	sha256   string
+}
+
+// sbomComponent is a Depfile entry, independent of the SBOM format.
+type sbomComponent struct {
+	kind      string
+	name      string
+	version   string
+	purl      string
+	homepage  string
+	artifacts []sbomArtifact
+}
+
+// SBOM creates a software bill of materials for all entries in the Depfile,
+// with their versions, download URLs and SHA256 hashes.
+// The format is either SBOMCycloneDX or SBOMSPDX.
+func SBOM(format string) ([]byte, error) {
+	if depFileConfig == nil {
+		return nil, errors.New("no Depfile found")
+	}
+
+	components := sbomComponents(depFileConfig)
+
+	switch strings.ToLower(format) {
+	case SBOMCycloneDX:
+		return json.MarshalIndent(cycloneDX(components), "", "  ")
+	case SBOMSPDX:
+		return json.MarshalIndent(spdx(components), "", "  ")
+	default:
+		return nil, errors.Wrap(ErrUnknownSBOMFormat, format)
+	}
+}
+
+func sbomComponents(cfg *depFile) []sbomComponent {
+	components := []sbomComponent{}
+
+	for _, name := range sortedKeys(cfg.Go) {
+		goBin := cfg.Go[name]
+		components = append(components, sbomComponent{
+			kind:    kindGo,
+			name:    name,
+			version: goBin.Version,
+			purl:    fmt.Sprintf("pkg:golang/%s@%s", goBin.ImportPath, goBin.Version),
+			// Go tools are built from source by 'go install', so there's no artifact to hash.
+			homepage: fmt.Sprintf("https://pkg.go.dev/%s@%s", goBin.ImportPath, goBin.Version),
+		})
+	}
+
+	for _, name := range sortedKeys(cfg.Bin) {
+		bin := cfg.Bin[name]
+		c := sbomComponent{
+			kind:    kindBin,
+			name:    name,
+			version: bin.Version,
+			purl:    fmt.Sprintf("pkg:generic/%s@%s", url.PathEscape(name), url.PathEscape(bin.Version)),
+		}
+
+		for _, platform := range sortedKeys(bin.SHA) {
+			goos, goarch, _ := strings.Cut(platform, "-")
+			c.artifacts = append(c.artifacts, sbomArtifact{
+				platform: platform,
+				url:      renderTemplate(bin.URL, bin.Version, goos, goarch),
+				sha256:   bin.SHA[platform],
+			})
+		}
+
+		components = append(components, c)
+	}
+
+	for _, name := range sortedKeys(cfg.Lib) {
+		lib := cfg.Lib[name]
+		c := sbomComponent{kind: kindLib, name: name, version: lib.Version}
+
+		switch {
+		case lib.Git != nil:
+			c.version = parseStringTemplate(lib.Git.Ref, lib.Version)
+			c.purl = fmt.Sprintf("pkg:generic/%s@%s?vcs_url=%s", url.PathEscape(name), url.PathEscape(c.version),
+				url.QueryEscape("git+"+lib.Git.Repo+"@"+c.version))
+			c.artifacts = []sbomArtifact{{url: lib.Git.Repo}}
+		case lib.Path != "":
+			// Local directories aren't third-party artifacts, but are listed for completeness.
+			c.purl = fmt.Sprintf("pkg:generic/%s", url.PathEscape(name))
+		default:
+			c.purl = fmt.Sprintf("pkg:generic/%s@%s", url.PathEscape(name), url.PathEscape(lib.Version))
+			c.artifacts = []sbomArtifact{{url: parseStringTemplate(lib.URL, lib.Version), sha256: lib.SHA}}
+		}
+
+		components = append(components, c)
+	}
+
+	for _, name := range sortedKeys(cfg.Image) {
+		img := cfg.Image[name]
+		repo, imageName := "", img.Name
+		if i := strings.LastIndex(img.Name, "/"); i >= 0 {
+			repo, imageName = img.Name[:i], img.Name[i+1:]
+		}
+
+		purl := fmt.Sprintf("pkg:oci/%s", url.PathEscape(imageName))
+		if img.Digest != "" {
+			purl += "@" + url.PathEscape(img.Digest)
+		}
+		query := url.Values{}
+		if repo != "" {
+			query.Set("repository_url", repo)
+		}
+		if img.Tag != "" {
+			query.Set("tag", img.Tag)
+		}
+		if len(query) != 0 {
+			purl += "?" + query.Encode()
+		}
+
+		components = append(components, sbomComponent{
+			kind:      kindImage,
+			name:      name,
+			version:   img.Tag,
+			purl:      purl,
+			artifacts: []sbomArtifact{{url: img.reference(), sha256: strings.TrimPrefix(img.Digest, "sha256:")}},
+		})
+	}
+
+	return components
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+type cdxBOM struct {
+	BOMFormat   string         `json:"bomFormat"`
+	SpecVersion string         `json:"specVersion"`
+	Version     int            `json:"version"`
+	Metadata    cdxMetadata    `json:"metadata"`
+	Components  []cdxComponent `json:"components"`
+}
+
+type cdxMetadata struct {
+	Timestamp string `json:"timestamp"`
+	Tools     struct {
+		Components []cdxComponent `json:"components"`
+	} `json:"tools"`
+}
+
+type cdxComponent struct {
+	Type               string        `json:"type"`
+	BOMRef             string        `json:"bom-ref,omitempty"`
+	Name               string        `json:"name"`
+	Version            string        `json:"version,omitempty"`
+	PURL               string        `json:"purl,omitempty"`
+	ExternalReferences []cdxExtRef   `json:"externalReferences,omitempty"`
+	Properties         []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxExtRef struct {
+	Type    string    `json:"type"`
+	URL     string    `json:"url"`
+	Comment string    `json:"comment,omitempty"`
+	Hashes  []cdxHash `json:"hashes,omitempty"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func cycloneDX(components []sbomComponent) *cdxBOM {
+	bom := &cdxBOM{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.5",
+		Version:     1,
+		Components:  []cdxComponent{},
+	}
+	bom.Metadata.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	bom.Metadata.Tools.Components = []cdxComponent{{Type: "application", Name: sbomToolName}}
+
+	for _, c := range components {
+		cdx := cdxComponent{
+			Type:       cdxType(c.kind),
+			BOMRef:     c.kind + ":" + c.name,
+			Name:       c.name,
+			Version:    c.version,
+			PURL:       c.purl,
+			Properties: []cdxProperty{{Name: "mage-loot:depfile:kind", Value: c.kind}},
+		}
+
+		if c.homepage != "" {
+			cdx.ExternalReferences = append(cdx.ExternalReferences, cdxExtRef{Type: "website", URL: c.homepage})
+		}
+
+		for _, a := range c.artifacts {
+			ref := cdxExtRef{Type: "distribution", URL: a.url, Comment: a.platform}
+			if a.sha256 != "" {
+				ref.Hashes = []cdxHash{{Alg: "SHA-256", Content: a.sha256}}
+			}
+			cdx.ExternalReferences = append(cdx.ExternalReferences, ref)
+		}
+
+		bom.Components = append(bom.Components, cdx)
+	}
+
+	return bom
+}
+
+func cdxType(kind string) string {
+	switch kind {
+	case kindLib:
+		return "library"
+	case kindImage:
+		return "container"
+	default:
+		return "application"
+	}
+}
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string         `json:"name"`
+	SPDXID           string         `json:"SPDXID"`
+	VersionInfo      string         `json:"versionInfo,omitempty"`
+	DownloadLocation string         `json:"downloadLocation"`
+	Homepage         string         `json:"homepage,omitempty"`
+	FilesAnalyzed    bool           `json:"filesAnalyzed"`
+	Checksums        []spdxChecksum `json:"checksums,omitempty"`
+	ExternalRefs     []spdxExtRef   `json:"externalRefs,omitempty"`
+	Comment          string         `json:"comment,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExtRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+func spdx(components []sbomComponent) *spdxDocument {
+	doc := &spdxDocument{
+		SPDXVersion: "SPDX-2.3",
+		DataLicense: "CC0-1.0",
+		SPDXID:      "SPDXRef-DOCUMENT",
+		Name:        "Depfile",
+		CreationInfo: spdxCreationInfo{
+			Created:  time.Now().UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: " + sbomToolName},
+		},
+		Packages:      []spdxPackage{},
+		Relationships: []spdxRelationship{},
+	}
+
+	// SPDX packages have a single download location, so every platform of a binary is its own package.
+	for _, c := range components {
+		artifacts := c.artifacts
+		if len(artifacts) == 0 {
+			artifacts = []sbomArtifact{{}}
+		}
+
+		for _, a := range artifacts {
+			id := c.kind + "-" + c.name
+			if a.platform != "" {
+				id += "-" + a.platform
+			}
+
+			pkg := spdxPackage{
+				Name:             c.name,
+				SPDXID:           "SPDXRef-" + spdxIDInvalidChars.ReplaceAllString(id, "-"),
+				VersionInfo:      c.version,
+				DownloadLocation: noAssertion,
+				Homepage:         c.homepage,
+				ExternalRefs: []spdxExtRef{{
+					ReferenceCategory: "PACKAGE-MANAGER",
+					ReferenceType:     "purl",
+					ReferenceLocator:  c.purl,
+				}},
+				Comment: strings.TrimSpace(c.kind + " " + a.platform),
+			}
+			if a.url != "" {
+				pkg.DownloadLocation = a.url
+			}
+			if a.sha256 != "" {
+				pkg.Checksums = []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: a.sha256}}
+			}
+
+			doc.Packages = append(doc.Packages, pkg)
+			doc.Relationships = append(doc.Relationships, spdxRelationship{
+				SPDXElementID:      doc.SPDXID,
+				RelationshipType:   "DESCRIBES",
+				RelatedSPDXElement: pkg.SPDXID,
+			})
+		}
+	}
+
+	// The namespace has to be unique per document, so it's derived from its content.
+	content, _ := json.Marshal(doc.Packages)
+	sum := sha256.Sum256(content)
+	doc.DocumentNamespace = "https://github.com/aserto-dev/mage-loot/spdx/depfile-" + hex.EncodeToString(sum[:8])
+
+	return doc
+}
@@ -0,0 +1,99 @@
+package deps_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/mage-loot/deps"
+)
+
+const sbomDepfile = `
+go:
+  sver:
+    importPath: "github.com/aserto-dev/sver/cmd/sver"
+    version: "v1.3.13"
+bin:
+  buf:
+    url: "https://github.com/bufbuild/buf/releases/download/v{{.Version}}/buf-{{.OS}}-{{.Arch}}"
+    version: "1.28.1"
+    sha:
+      linux-amd64: "aaaa"
+      darwin-arm64: "bbbb"
+lib:
+  googleapis:
+    url: "https://example.com/googleapis-{{.Version}}.tgz"
+    version: "1.0.0"
+    sha: "cccc"
+`
+
+func TestSBOMCycloneDX(t *testing.T) {
+	assert := require.New(t)
+	assert.NoError(deps.SetDepfile(sbomDepfile))
+
+	out, err := deps.SBOM(deps.SBOMCycloneDX)
+	assert.NoError(err)
+
+	var bom struct {
+		BOMFormat  string `json:"bomFormat"`
+		Components []struct {
+			Name               string `json:"name"`
+			Version            string `json:"version"`
+			PURL               string `json:"purl"`
+			ExternalReferences []struct {
+				URL     string `json:"url"`
+				Comment string `json:"comment"`
+				Hashes  []struct {
+					Content string `json:"content"`
+				} `json:"hashes"`
+			} `json:"externalReferences"`
+		} `json:"components"`
+	}
+	assert.NoError(json.Unmarshal(out, &bom))
+	assert.Equal("CycloneDX", bom.BOMFormat)
+	assert.Len(bom.Components, 3)
+
+	sver := bom.Components[0]
+	assert.Equal("pkg:golang/github.com/aserto-dev/sver/cmd/sver@v1.3.13", sver.PURL)
+
+	buf := bom.Components[1]
+	assert.Equal("1.28.1", buf.Version)
+	assert.Len(buf.ExternalReferences, 2)
+	assert.Equal("darwin-arm64", buf.ExternalReferences[0].Comment)
+	assert.Equal("https://github.com/bufbuild/buf/releases/download/v1.28.1/buf-darwin-arm64", buf.ExternalReferences[0].URL)
+	assert.Equal("bbbb", buf.ExternalReferences[0].Hashes[0].Content)
+
+	googleapis := bom.Components[2]
+	assert.Equal("https://example.com/googleapis-1.0.0.tgz", googleapis.ExternalReferences[0].URL)
+	assert.Equal("cccc", googleapis.ExternalReferences[0].Hashes[0].Content)
+}
+
+func TestSBOMSPDX(t *testing.T) {
+	assert := require.New(t)
+	assert.NoError(deps.SetDepfile(sbomDepfile))
+
+	out, err := deps.SBOM(deps.SBOMSPDX)
+	assert.NoError(err)
+
+	var doc struct {
+		SPDXVersion string `json:"spdxVersion"`
+		Packages    []struct {
+			SPDXID           string `json:"SPDXID"`
+			DownloadLocation string `json:"downloadLocation"`
+		} `json:"packages"`
+		Relationships []any `json:"relationships"`
+	}
+	assert.NoError(json.Unmarshal(out, &doc))
+	assert.Equal("SPDX-2.3", doc.SPDXVersion)
+
+	// One package per platform of each binary.
+	assert.Len(doc.Packages, 4)
+	assert.Len(doc.Relationships, 4)
+	assert.Equal("SPDXRef-go-sver", doc.Packages[0].SPDXID)
+	assert.Equal("NOASSERTION", doc.Packages[0].DownloadLocation)
+	assert.Equal("SPDXRef-bin-buf-linux-amd64", doc.Packages[2].SPDXID)
+
+	_, err = deps.SBOM("swid")
+	assert.ErrorIs(err, deps.ErrUnknownSBOMFormat)
+}
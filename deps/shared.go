@@ -7,8 +7,11 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"time"
 
+	"github.com/aserto-dev/mage-loot/fsutil"
 	"github.com/pkg/errors"
 )
 
@@ -18,6 +21,15 @@ const (
 	goBinDir    = "gobin"
 	libDir      = "lib"
 	tmpDir      = "tmp"
+
+	// FormatZip is a zip archive.
+	FormatZip = "zip"
+	// FormatTGz is a tarred and gzipped archive.
+	FormatTGz = "tgz"
+	// FormatTXz is a tarred and xz compressed archive.
+	FormatTXz = "txz"
+	// FormatRaw is a file that isn't an archive, like a binary.
+	FormatRaw = "raw"
 )
 
 var (
@@ -25,10 +37,16 @@ var (
 )
 
 type depOptions struct {
-	zipPaths  []string
-	tgzPaths  []string
-	txzPaths  []string
-	libPrefix string
+	zipPaths     []string
+	tgzPaths     []string
+	txzPaths     []string
+	libPrefix    string
+	postInstall  []string
+	versionCheck *VersionCheck
+	entrypoints  map[string]string
+	gitPaths     []string
+	format       string
+	headers      map[string]string
 }
 
 // Option is a setting that changes the behavior
@@ -59,6 +77,14 @@ func WithTXzPaths(paths ...string) Option {
 	}
 }
 
+// WithGitPaths tells us which files to copy from
+// a lib cloned from a git repository, as glob patterns.
+func WithGitPaths(paths ...string) Option {
+	return func(o *depOptions) {
+		o.gitPaths = paths
+	}
+}
+
 // WithLibPrefix tells us we should remove the specified
 // prefix from the lib paths.
 // This option can use the {{.Version}} template.
@@ -68,18 +94,84 @@ func WithLibPrefix(prefix string) Option {
 	}
 }
 
+// WithEntrypoints names additional executables of a binary dependency, mapping
+// each name to a file in the binary's directory. They can be run using 'name:entrypoint'.
+func WithEntrypoints(entrypoints map[string]string) Option {
+	return func(o *depOptions) {
+		o.entrypoints = entrypoints
+	}
+}
+
+// WithPostInstall specifies shell commands that are run after a binary
+// is extracted, from inside the directory it's installed to.
+func WithPostInstall(commands ...string) Option {
+	return func(o *depOptions) {
+		o.postInstall = commands
+	}
+}
+
+// WithVersionCheck makes sure a binary reports the pinned version after it's procured.
+// The binary is run with args, and the first submatch of regex (or the whole match if
+// there's no group) in its output must equal the version, ignoring a leading 'v'.
+func WithVersionCheck(args []string, regex string) Option {
+	return func(o *depOptions) {
+		o.versionCheck = &VersionCheck{Args: args, Regex: regex}
+	}
+}
+
+// WithFormat sets the format of the downloaded file, instead of
+// guessing it from the URL's extension. It's one of FormatZip,
+// FormatTGz, FormatTXz or FormatRaw.
+func WithFormat(format string) Option {
+	return func(o *depOptions) {
+		o.format = format
+	}
+}
+
+// WithHeaders adds HTTP headers to the download request, e.g. for authentication.
+// Env vars in header values (like '$GITHUB_TOKEN') are expanded when downloading.
+func WithHeaders(headers map[string]string) Option {
+	return func(o *depOptions) {
+		o.headers = headers
+	}
+}
+
+// archiveFormat returns the format of a download, which is either
+// set explicitly or guessed from the URL's extension.
+func archiveFormat(url, format string) string {
+	if format != "" {
+		return format
+	}
+
+	switch path.Ext(url) {
+	case ".zip":
+		return FormatZip
+	case ".tgz", ".gz":
+		return FormatTGz
+	case ".txz", ".xz":
+		return FormatTXz
+	default:
+		return FormatRaw
+	}
+}
+
 // downloadFile will download a url to a local file.
-func downloadFile(filePath, url string) error {
+func downloadFile(kind, name, filePath, url string, headers map[string]string) error {
 	dir := filepath.Dir(filePath)
 	err := os.MkdirAll(dir, 0700)
 	if err != nil {
 		panic(errors.Wrapf(err, "failed to create dir '%s'", dir))
 	}
 
+	start := time.Now()
+
 	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, http.NoBody)
 	if err != nil {
 		panic(errors.Wrap(err, "failed to create http request"))
 	}
+	for key, value := range headers {
+		req.Header.Set(key, os.ExpandEnv(value))
+	}
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		panic(errors.Wrap(err, "http get request failed"))
@@ -92,11 +184,25 @@ func downloadFile(filePath, url string) error {
 	}
 	defer out.Close()
 
-	_, err = io.Copy(out, resp.Body)
+	progress := &progressWriter{
+		event: Event{Kind: kind, Name: name, URL: url, Path: filePath, TotalBytes: resp.ContentLength},
+		start: start,
+	}
+	startEvent := progress.event
+	emit(func(l Listener) { l.OnDownloadStart(startEvent) })
+
+	_, err = io.Copy(io.MultiWriter(out, progress), resp.Body)
+
+	doneEvent := progress.event
+	doneEvent.Duration = time.Since(start)
+	emit(func(l Listener) { l.OnDownloadDone(doneEvent) })
+
 	return err
 }
 
-func verifyFile(filePath, sha string) {
+func verifyFile(kind, name, filePath, sha string) {
+	start := time.Now()
+
 	f, err := os.Open(filePath)
 	if err != nil {
 		panic(errors.Wrapf(err, "failed to open file '%s' for calculating sha", filePath))
@@ -104,10 +210,14 @@ func verifyFile(filePath, sha string) {
 	defer f.Close()
 
 	hasher := sha256.New()
-	if _, err := io.Copy(hasher, f); err != nil {
+	size, err := io.Copy(hasher, f)
+	if err != nil {
 		panic(errors.Wrapf(err, "failed to calculate sha for file '%s'", filePath))
 	}
 
+	e := Event{Kind: kind, Name: name, Path: filePath, Bytes: size, TotalBytes: size, Duration: time.Since(start)}
+	emit(func(l Listener) { l.OnVerify(e) })
+
 	value := hex.EncodeToString(hasher.Sum(nil))
 
 	if value != sha {
@@ -115,6 +225,32 @@ func verifyFile(filePath, sha string) {
 	}
 }
 
+// extractArchive unpacks an archive and reports how long it took.
+func extractArchive(kind, name, extension, src, dest string) error {
+	start := time.Now()
+
+	err := fsutil.Extract(extension, src, dest)
+	if err != nil {
+		return err
+	}
+
+	var size int64
+	if info, err := os.Stat(src); err == nil {
+		size = info.Size()
+	}
+
+	e := Event{Kind: kind, Name: name, Path: dest, Bytes: size, TotalBytes: size, Duration: time.Since(start)}
+	emit(func(l Listener) { l.OnExtract(e) })
+
+	return nil
+}
+
+// cacheHit notifies listeners that a dependency was already procured.
+func cacheHit(kind, name, path string) {
+	e := Event{Kind: kind, Name: name, Path: path}
+	emit(func(l Listener) { l.OnCacheHit(e) })
+}
+
 // BinDir returns the absolute path to the bin directory of tools
 // that are not go.
 func BinDir() string {
@@ -0,0 +1,303 @@
+package deps
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aserto-dev/mage-loot/fsutil"
+	"github.com/pkg/errors"
+)
+
+const (
+	probeTimeout = 10 * time.Second
+
+	statusOK       = "ok"
+	statusMismatch = "mismatch"
+	statusFailed   = "failed"
+	statusNone     = "-"
+)
+
+// ErrDrift is returned by Status when installed dependencies don't match the Depfile.
+var ErrDrift = errors.New("dependencies drifted from the Depfile")
+
+// defaultProbe are the arguments used to check that a binary runs,
+// unless a Depfile entry specifies its own 'probe'.
+var defaultProbe = []string{"--version"}
+
+type depStatus struct {
+	kind     string
+	name     string
+	version  string
+	procured bool
+	path     string
+	size     int64
+	sha      string
+	runs     string
+}
+
+func (s *depStatus) drifted() bool {
+	return !s.procured || s.sha == statusMismatch || s.runs == statusFailed || s.runs == statusMismatch
+}
+
+// Status lists every Depfile entry with its procurement state.
+// Installed files are re-hashed and compared with what was recorded when they were procured,
+// and binaries are probed (by default using '--version') to check that they run.
+// It returns ErrDrift if any dependency is missing, was modified or doesn't run.
+func Status() error {
+	if depFileConfig == nil {
+		ui.Exclamation().Msg("No Depfile found.")
+		return nil
+	}
+
+	statuses := collectStatus(depFileConfig)
+
+	table := ui.Normal().WithTable("Kind", "Name", "Version", "Procured", "Path", "Size", "SHA", "Runs")
+	drifted := 0
+	for _, s := range statuses {
+		if s.drifted() {
+			drifted++
+		}
+
+		table.WithTableRow(s.kind, s.name, s.version, fmt.Sprint(s.procured), relPath(s.path), fsutil.FormatSize(s.size), s.sha, s.runs)
+	}
+	table.Do()
+
+	if drifted > 0 {
+		ui.Problem().Msgf("%d of %d dependencies drifted.", drifted, len(statuses))
+		return errors.Wrapf(ErrDrift, "%d of %d dependencies", drifted, len(statuses))
+	}
+
+	ui.Success().Msg("All dependencies are procured.")
+	return nil
+}
+
+func collectStatus(cfg *depFile) []*depStatus {
+	statuses := []*depStatus{}
+
+	for name, goBin := range cfg.Go {
+		entrypoint := parseStringTemplate(goBin.Entrypoint, goBin.Version)
+		if goBin.Entrypoint == "" {
+			entrypoint = name
+		}
+
+		s := &depStatus{kind: kindGo, name: name, version: goBin.Version}
+		installedStatus(s, goBinFilePath(name, goBin.Version), entrypoint, "", goBin.Probe, nil)
+		statuses = append(statuses, s)
+	}
+
+	for name, bin := range cfg.Bin { //nolint:gocritic // TODO refactor
+		entrypoint := parseStringTemplate(bin.Entrypoint, bin.Version)
+		if bin.Entrypoint == "" {
+			entrypoint = name
+		}
+
+		// Only plain binaries can be compared with the Depfile SHA, archives are unpacked.
+		sha := ""
+		if len(bin.ZipPaths) == 0 && len(bin.TGzPaths) == 0 && len(bin.TXzPaths) == 0 {
+			sha = bin.SHA[platform()]
+		}
+
+		s := &depStatus{kind: kindBin, name: name, version: bin.Version}
+		installedStatus(s, binFilePath(name, bin.Version), entrypoint, sha, bin.Probe, bin.VersionCheck)
+		statuses = append(statuses, s)
+	}
+
+	for name, lib := range cfg.Lib { //nolint:gocritic // TODO refactor
+		s := &depStatus{kind: kindLib, name: name, version: lib.Version, sha: statusNone, runs: statusNone}
+		s.path = libOutputPath(lib.OutputDir)
+		s.size, s.procured = libTargetsStatus(lib)
+		statuses = append(statuses, s)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].kind != statuses[j].kind {
+			return statuses[i].kind < statuses[j].kind
+		}
+		return statuses[i].name < statuses[j].name
+	})
+
+	return statuses
+}
+
+// installedStatus fills in the status of a go or bin dependency installed in dir.
+// If sha isn't empty, the entrypoint must also match it.
+// If check isn't nil, it's used instead of the probe to also verify the reported version.
+func installedStatus(s *depStatus, dir, entrypoint, sha string, probe []string, check *VersionCheck) {
+	entrypoint = exeName(entrypoint)
+	s.path = filepath.Join(dir, entrypoint)
+	s.sha = statusNone
+	s.runs = statusNone
+
+	s.procured = isProcured(dir)
+	if !s.procured {
+		return
+	}
+
+	s.size, _ = dirSize(dir)
+	s.sha = verifyInstalled(dir, entrypoint, sha)
+
+	if check != nil {
+		if check.Args == nil {
+			check = &VersionCheck{Args: probe, Regex: check.Regex}
+		}
+
+		s.runs = statusOK
+		if err := checkVersion(s.path, s.version, check); errors.Is(err, ErrVersionMismatch) {
+			s.runs = statusMismatch
+		} else if err != nil {
+			s.runs = statusFailed
+		}
+		return
+	}
+
+	if probe == nil {
+		probe = defaultProbe
+	}
+	if len(probe) != 0 {
+		s.runs = statusOK
+		if _, err := probeBinary(s.path, probe...); err != nil {
+			s.runs = statusFailed
+		}
+	}
+}
+
+// verifyInstalled re-hashes the files in dir and compares them with the manifest.
+func verifyInstalled(dir, entrypoint, sha string) string {
+	m, err := readManifest(dir)
+	if err != nil {
+		return statusFailed
+	}
+
+	files, err := hashDir(dir)
+	if err != nil {
+		return statusFailed
+	}
+
+	if len(files) != len(m.Files) {
+		return statusMismatch
+	}
+	for f, sum := range m.Files {
+		if files[f] != sum {
+			return statusMismatch
+		}
+	}
+
+	if sha != "" && files[filepath.ToSlash(entrypoint)] != sha {
+		return statusMismatch
+	}
+
+	return statusOK
+}
+
+// libTargetsStatus returns the total size of the files installed by a lib and whether all of them exist.
+// Only the lib's own targets are checked, as several libs can share an output dir.
+func libTargetsStatus(lib LibSpec) (int64, bool) { //nolint:gocritic // specs are passed by value like in the Depfile
+	targets := libTargets(lib)
+	if len(targets) == 0 {
+		return 0, false
+	}
+
+	var total int64
+	for _, target := range targets {
+		matches, err := filepath.Glob(filepath.Join(LibDir(), target))
+		if err != nil || len(matches) == 0 {
+			return total, false
+		}
+
+		for _, m := range matches {
+			size, _ := dirSize(m)
+			total += size
+		}
+	}
+
+	return total, true
+}
+
+// libTargets returns the glob patterns of the files a lib installs, relative to the lib dir.
+func libTargets(lib LibSpec) []string { //nolint:gocritic // specs are passed by value like in the Depfile
+	if lib.Path != "" {
+		return []string{filepath.Join(lib.OutputDir, filepath.Base(lib.Path))}
+	}
+
+	var patterns []string
+	switch {
+	case lib.Git != nil:
+		patterns = lib.Git.Paths
+	default:
+		patterns = append(append(append(patterns, lib.ZipPaths...), lib.TGzPaths...), lib.TXzPaths...)
+	}
+
+	prefix := parseStringTemplate(lib.LibPrefix, lib.Version)
+
+	targets := []string{}
+	for _, pattern := range parseArrayTemplate(patterns, lib.Version) {
+		targets = append(targets, filepath.Join(lib.OutputDir, trimPatternPrefix(pattern, prefix)))
+	}
+
+	return targets
+}
+
+// trimPatternPrefix removes the leading path segments of a glob pattern that match the prefix,
+// like installLibFiles does for the files matching the pattern.
+func trimPatternPrefix(pattern, prefix string) string {
+	if prefix == "" {
+		return pattern
+	}
+
+	segments := strings.Split(filepath.ToSlash(filepath.Clean(pattern)), "/")
+	prefixSegments := strings.Split(filepath.ToSlash(filepath.Clean(prefix)), "/")
+	if len(segments) <= len(prefixSegments) {
+		return pattern
+	}
+
+	for i, p := range prefixSegments {
+		if ok, err := filepath.Match(segments[i], p); err != nil || !ok {
+			return pattern
+		}
+	}
+
+	return filepath.Join(segments[len(prefixSegments):]...)
+}
+
+// probeBinary runs a binary with the given arguments and returns its combined output.
+func probeBinary(binPath string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, binPath, args...).CombinedOutput()
+	return string(out), err
+}
+
+// dirSize returns the total size of the files in dir and whether it exists.
+func dirSize(dir string) (int64, bool) {
+	var size int64
+
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() && d.Name() != procuredMarker {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+
+	return size, err == nil
+}
+
+func relPath(p string) string {
+	if rel, err := filepath.Rel(currentDir, p); err == nil {
+		return rel
+	}
+	return p
+}
@@ -0,0 +1,103 @@
+package deps_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/mage-loot/deps"
+)
+
+func TestStatusBin(t *testing.T) {
+	assert := require.New(t)
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the probed binary is a shell script")
+	}
+
+	deps.SetListener(deps.NopListener{})
+	deps.SetCurrentDir(t.TempDir())
+
+	content := []byte("#!/bin/sh\necho 1.0.0\n")
+	srv, _, sha := binServer(t, content)
+
+	assert.NoError(deps.SetDepfile(fmt.Sprintf(`
+bin:
+  status:
+    url: %q
+    version: "1.0.0"
+    sha:
+      %s-%s: %q
+`, srv.URL+"/status", runtime.GOOS, runtime.GOARCH, sha)))
+
+	assert.ErrorIs(deps.Status(), deps.ErrDrift)
+	procured, _, _ := deps.DepStatus("bin", "status")
+	assert.False(procured)
+
+	deps.DefBinDep("status", srv.URL+"/status", "1.0.0", sha, "status")
+	binPath := deps.BinPath("status")
+
+	assert.NoError(deps.Status())
+	procured, shaStatus, runs := deps.DepStatus("bin", "status")
+	assert.True(procured)
+	assert.Equal("ok", shaStatus)
+	assert.Equal("ok", runs)
+
+	assert.NoError(os.WriteFile(binPath, []byte("#!/bin/sh\nexit 1\n"), 0700)) //nolint:gosec // a fake binary
+	assert.ErrorIs(deps.Status(), deps.ErrDrift)
+	_, shaStatus, runs = deps.DepStatus("bin", "status")
+	assert.Equal("mismatch", shaStatus)
+	assert.Equal("failed", runs)
+}
+
+func TestStatusLibsSharingOutputDir(t *testing.T) {
+	assert := require.New(t)
+	deps.SetListener(deps.NopListener{})
+	deps.SetCurrentDir(t.TempDir())
+
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "alpha", "alpha.proto"), "alpha")
+	writeFile(t, filepath.Join(src, "beta", "beta.proto"), "beta")
+
+	archive := tgz(t, map[string]string{"gamma-1.0.0/protos/gamma.proto": "gamma"})
+	srv, _, sha := binServer(t, archive)
+
+	assert.NoError(deps.SetDepfile(fmt.Sprintf(`
+lib:
+  alpha:
+    path: %q
+  beta:
+    path: %q
+  gamma:
+    url: %q
+    version: "1.0.0"
+    sha: %q
+    libPrefix: "gamma-{{.Version}}"
+    tgzPaths:
+    - "*/protos/*.proto"
+`, filepath.Join(src, "alpha"), filepath.Join(src, "beta"), srv.URL+"/gamma.tgz", sha)))
+
+	deps.DefPathLibDep("alpha", filepath.Join(src, "alpha"), "")
+	deps.LibPath("alpha")
+
+	procured, _, _ := deps.DepStatus("lib", "alpha")
+	assert.True(procured)
+	procured, _, _ = deps.DepStatus("lib", "beta")
+	assert.False(procured, "beta shares the lib dir with alpha, but wasn't procured")
+	procured, _, _ = deps.DepStatus("lib", "gamma")
+	assert.False(procured)
+
+	deps.DefLibDep("gamma", srv.URL+"/gamma.tgz", sha, "",
+		deps.WithTGzPaths("*/protos/*.proto"),
+		deps.WithLibPrefix("gamma-1.0.0"),
+	)
+	assert.FileExists(filepath.Join(deps.LibPath("gamma"), "protos", "gamma.proto"))
+
+	procured, _, _ = deps.DepStatus("lib", "gamma")
+	assert.True(procured)
+	assert.ErrorIs(deps.Status(), deps.ErrDrift)
+}
@@ -2,7 +2,6 @@ package deps
 
 import (
 	"bytes"
-	"runtime"
 	"text/template"
 
 	"github.com/pkg/errors"
@@ -15,11 +14,15 @@ type deps struct {
 }
 
 func parseStringTemplate(tpl, version string) string {
+	return renderTemplate(tpl, version, goos, goarch)
+}
 
+// renderTemplate renders a Depfile template for the given OS and architecture.
+func renderTemplate(tpl, version, goos, goarch string) string {
 	d := deps{
 		Version: version,
-		Arch:    runtime.GOARCH,
-		OS:      runtime.GOOS,
+		Arch:    goarch,
+		OS:      goos,
 	}
 	t := template.Must(template.New("tml").Parse(tpl))
 
@@ -41,28 +41,11 @@ func newCLI(cfg *config, ui *clui.UI) (*dockerCLI, error) {
 
 func (cli *dockerCLI) startContainer(ctx context.Context, containerName string) error {
 	img := cli.cfg.containerConfig.Image
-	cli.ui.Note().Msgf("checking image %s", img)
-	imagePullOptions := image.PullOptions{}
-	if cli.cfg.credentials != nil {
-		encodedJSON, err := json.Marshal(cli.cfg.credentials)
-		if err != nil {
-			return err
-		}
-		authStr := base64.URLEncoding.EncodeToString(encodedJSON)
-		imagePullOptions.RegistryAuth = authStr
-	}
-
-	ioReader, err := cli.dockerClient.ImagePull(ctx, img, imagePullOptions)
-	if err != nil {
-		return errors.Wrapf(err, "failed to pull image [%s]", img)
-	}
-	_, err = io.Copy(cli.ui.Output(), ioReader)
+	err := cli.pullImage(ctx, img)
 	if err != nil {
 		return err
 	}
 
-	defer ioReader.Close()
-
 	ui.Note().Msg("creating docker container")
 
 	var networkConfig *network.NetworkingConfig
@@ -108,6 +91,28 @@ func (cli *dockerCLI) startContainer(ctx context.Context, containerName string)
 	return nil
 }
 
+func (cli *dockerCLI) pullImage(ctx context.Context, img string) error {
+	cli.ui.Note().Msgf("checking image %s", img)
+	imagePullOptions := image.PullOptions{}
+	if cli.cfg.credentials != nil {
+		encodedJSON, err := json.Marshal(cli.cfg.credentials)
+		if err != nil {
+			return err
+		}
+		authStr := base64.URLEncoding.EncodeToString(encodedJSON)
+		imagePullOptions.RegistryAuth = authStr
+	}
+
+	ioReader, err := cli.dockerClient.ImagePull(ctx, img, imagePullOptions)
+	if err != nil {
+		return errors.Wrapf(err, "failed to pull image [%s]", img)
+	}
+	defer ioReader.Close()
+
+	_, err = io.Copy(cli.ui.Output(), ioReader)
+	return err
+}
+
 func (cli *dockerCLI) removeContainer(ctx context.Context, containerName string) error {
 	cli.ui.Note().Msgf("removing container with name [%s]", containerName)
 	err := cli.dockerClient.ContainerRemove(ctx, containerName, container.RemoveOptions{
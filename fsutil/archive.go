@@ -0,0 +1,123 @@
+package fsutil
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// ArchiveFile is a file added to an archive.
+type ArchiveFile struct {
+	// Path is the file on disk.
+	Path string
+	// Name is the path of the file inside the archive, using forward slashes.
+	Name string
+}
+
+// CreateTarGz creates a tarred and gzipped archive with the given files.
+func CreateTarGz(dest string, files ...ArchiveFile) error {
+	out, err := os.Create(dest)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create archive '%s'", dest)
+	}
+	defer out.Close()
+
+	gzipWriter := gzip.NewWriter(out)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	for _, f := range files {
+		if err := addTarFile(tarWriter, f); err != nil {
+			return err
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return errors.Wrap(err, "failed to write tar stream")
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return errors.Wrap(err, "failed to write gzip stream")
+	}
+
+	return out.Close()
+}
+
+func addTarFile(tarWriter *tar.Writer, f ArchiveFile) error {
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to stat '%s'", f.Path)
+	}
+
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return errors.Wrapf(err, "failed to create tar header for '%s'", f.Path)
+	}
+	header.Name = f.Name
+
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return errors.Wrapf(err, "failed to write tar header for '%s'", f.Path)
+	}
+
+	return copyFileTo(tarWriter, f.Path)
+}
+
+// CreateZip creates a zip archive with the given files.
+func CreateZip(dest string, files ...ArchiveFile) error {
+	out, err := os.Create(dest)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create archive '%s'", dest)
+	}
+	defer out.Close()
+
+	zipWriter := zip.NewWriter(out)
+
+	for _, f := range files {
+		if err := addZipFile(zipWriter, f); err != nil {
+			return err
+		}
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		return errors.Wrap(err, "failed to write zip stream")
+	}
+
+	return out.Close()
+}
+
+func addZipFile(zipWriter *zip.Writer, f ArchiveFile) error {
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to stat '%s'", f.Path)
+	}
+
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create zip header for '%s'", f.Path)
+	}
+	header.Name = f.Name
+	header.Method = zip.Deflate
+
+	w, err := zipWriter.CreateHeader(header)
+	if err != nil {
+		return errors.Wrapf(err, "failed to write zip header for '%s'", f.Path)
+	}
+
+	return copyFileTo(w, f.Path)
+}
+
+func copyFileTo(w io.Writer, filePath string) error {
+	in, err := os.Open(filePath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open '%s'", filePath)
+	}
+	defer in.Close()
+
+	if _, err := io.Copy(w, in); err != nil {
+		return errors.Wrapf(err, "failed to add '%s' to archive", filePath)
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package fsutil_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/mage-loot/fsutil"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	for _, ext := range []string{"tgz", "zip"} {
+		t.Run(ext, func(t *testing.T) {
+			assert := require.New(t)
+			dir := t.TempDir()
+
+			binPath := filepath.Join(dir, "tool")
+			assert.NoError(os.WriteFile(binPath, []byte("binary"), 0700))
+			readmePath := filepath.Join(dir, "README.md")
+			assert.NoError(os.WriteFile(readmePath, []byte("# tool"), 0600))
+
+			files := []fsutil.ArchiveFile{
+				{Path: binPath, Name: "tool"},
+				{Path: readmePath, Name: "docs/README.md"},
+			}
+
+			archive := filepath.Join(dir, "tool."+ext)
+			if ext == "zip" {
+				assert.NoError(fsutil.CreateZip(archive, files...))
+			} else {
+				assert.NoError(fsutil.CreateTarGz(archive, files...))
+			}
+
+			dest := filepath.Join(dir, "out")
+			assert.NoError(os.MkdirAll(dest, 0700))
+			assert.NoError(fsutil.Extract(ext, archive, dest))
+
+			content, err := os.ReadFile(filepath.Join(dest, "tool"))
+			assert.NoError(err)
+			assert.Equal("binary", string(content))
+
+			info, err := os.Stat(filepath.Join(dest, "tool"))
+			assert.NoError(err)
+			assert.Equal(os.FileMode(0700), info.Mode().Perm())
+
+			content, err = os.ReadFile(filepath.Join(dest, "docs", "README.md"))
+			assert.NoError(err)
+			assert.Equal("# tool", string(content))
+		})
+	}
+}
@@ -30,7 +30,9 @@ func Unzip(src, dest string) ([]string, error) {
 	defer r.Close()
 
 	for _, f := range r.File {
-		fpath := filepath.Join(dest, f.Name) // nolint:gosec // check ZipSlip below
+		// Archives created on Windows sometimes use backslashes as separators.
+		name := filepath.FromSlash(strings.ReplaceAll(f.Name, `\`, "/"))
+		fpath := filepath.Join(dest, name) // nolint:gosec // check ZipSlip below
 
 		// Check for ZipSlip. More Info: http://bit.ly/2MsjAWE
 		if !strings.HasPrefix(fpath, filepath.Clean(dest)+string(os.PathSeparator)) {
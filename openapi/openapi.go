@@ -19,6 +19,13 @@ const (
 // GenerateOpenAPI generates code for the specified Open API definition
 // the openAPI definition path must be relative to the current working directory.
 func GenerateOpenAPI(version, openAPIDefinitionPath, packageName, outputDir, generatorType string, additionalArgs ...string) error {
+	return GenerateOpenAPIWithImage(fmt.Sprintf("%s:%s", openAPIDockerImage, version),
+		openAPIDefinitionPath, packageName, outputDir, generatorType, additionalArgs...)
+}
+
+// GenerateOpenAPIWithImage is like GenerateOpenAPI, but runs the given openapi-generator-cli image,
+// e.g. one defined in the Depfile and obtained using deps.Image.
+func GenerateOpenAPIWithImage(image, openAPIDefinitionPath, packageName, outputDir, generatorType string, additionalArgs ...string) error {
 	currentDir, err := os.Getwd()
 	if err != nil {
 		return errors.Wrap(err, "failed to get working directory")
@@ -74,7 +81,7 @@ func GenerateOpenAPI(version, openAPIDefinitionPath, packageName, outputDir, gen
 	err = sh.Run("docker", append([]string{"run", "--rm",
 		"-u", fmt.Sprintf("%s:%s", currentUser.Uid, currentUser.Gid),
 		"-v", fmt.Sprintf("%s:/local", currentDir),
-		fmt.Sprintf("%s:%s", openAPIDockerImage, version),
+		image,
 		"generate", "-i", openapiContainerPath, "-g", generatorType, "-o", outputContainerPath},
 		additionalArgs...)...)
 
@@ -0,0 +1,210 @@
+// Package semver parses and compares semantic versions (https://semver.org).
+// A leading 'v' is accepted, as it's common in git tags and go modules.
+package semver
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrInvalidVersion = errors.New("invalid semantic version")
+
+	versionRegex = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+		`(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?` +
+		`(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+)
+
+// Version is a parsed semantic version.
+type Version struct {
+	Major      uint64
+	Minor      uint64
+	Patch      uint64
+	PreRelease []string
+	Build      []string
+}
+
+// Parse parses a semantic version like '1.2.3', 'v1.2.3-rc.1' or '1.2.3+dirty'.
+func Parse(version string) (*Version, error) {
+	m := versionRegex.FindStringSubmatch(strings.TrimSpace(version))
+	if m == nil {
+		return nil, errors.Wrapf(ErrInvalidVersion, "'%s'", version)
+	}
+
+	v := &Version{}
+	v.Major, _ = strconv.ParseUint(m[1], 10, 64)
+	v.Minor, _ = strconv.ParseUint(m[2], 10, 64)
+	v.Patch, _ = strconv.ParseUint(m[3], 10, 64)
+
+	if m[4] != "" {
+		v.PreRelease = strings.Split(m[4], ".")
+	}
+	if m[5] != "" {
+		v.Build = strings.Split(m[5], ".")
+	}
+
+	return v, nil
+}
+
+// MustParse is like Parse, but panics if the version is invalid.
+func MustParse(version string) *Version {
+	v, err := Parse(version)
+	if err != nil {
+		panic(err)
+	}
+
+	return v
+}
+
+// String formats the version without a leading 'v'.
+func (v *Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.PreRelease) != 0 {
+		s += "-" + strings.Join(v.PreRelease, ".")
+	}
+	if len(v.Build) != 0 {
+		s += "+" + strings.Join(v.Build, ".")
+	}
+
+	return s
+}
+
+// Compare returns -1, 0 or 1 if v is lower than, equal to or greater than other.
+// Build metadata is ignored, as required by the spec.
+func (v *Version) Compare(other *Version) int {
+	if c := compareUint(v.Major, other.Major); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Minor, other.Minor); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Patch, other.Patch); c != 0 {
+		return c
+	}
+
+	return comparePreRelease(v.PreRelease, other.PreRelease)
+}
+
+// LessThan returns true if v has a lower precedence than other.
+func (v *Version) LessThan(other *Version) bool {
+	return v.Compare(other) < 0
+}
+
+// Compare parses and compares two versions, see Version.Compare.
+func Compare(a, b string) (int, error) {
+	va, err := Parse(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := Parse(b)
+	if err != nil {
+		return 0, err
+	}
+
+	return va.Compare(vb), nil
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// comparePreRelease compares pre-release identifiers.
+// A version without pre-release identifiers has a higher precedence than one with.
+func comparePreRelease(a, b []string) int {
+	switch {
+	case len(a) == 0 && len(b) == 0:
+		return 0
+	case len(a) == 0:
+		return 1
+	case len(b) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := compareIdentifier(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+
+	return compareUint(uint64(len(a)), uint64(len(b)))
+}
+
+// compareIdentifier compares numeric identifiers numerically and others lexically.
+// Numeric identifiers have a lower precedence than alphanumeric ones.
+func compareIdentifier(a, b string) int {
+	na, errA := strconv.ParseUint(a, 10, 64)
+	nb, errB := strconv.ParseUint(b, 10, 64)
+
+	switch {
+	case errA == nil && errB == nil:
+		return compareUint(na, nb)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+const (
+	PartMajor      = "major"
+	PartMinor      = "minor"
+	PartPatch      = "patch"
+	PartPreRelease = "prerelease"
+)
+
+var ErrInvalidPart = errors.New("invalid version part")
+
+// Next returns the next version, incrementing the given part: PartMajor, PartMinor, PartPatch
+// or PartPreRelease. A pre-release is released by incrementing the part it's a pre-release of,
+// so the next minor version of '1.3.0-rc.1' is '1.3.0'. Incrementing the pre-release works like npm:
+// '1.2.3' becomes '1.2.4-0', and '1.2.4-rc.1' becomes '1.2.4-rc.2'. Build metadata is dropped.
+func (v *Version) Next(part string) (*Version, error) {
+	next := &Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch}
+	preRelease := len(v.PreRelease) != 0
+
+	switch part {
+	case PartMajor:
+		if !preRelease || v.Minor != 0 || v.Patch != 0 {
+			next.Major, next.Minor, next.Patch = v.Major+1, 0, 0
+		}
+	case PartMinor:
+		if !preRelease || v.Patch != 0 {
+			next.Minor, next.Patch = v.Minor+1, 0
+		}
+	case PartPatch:
+		if !preRelease {
+			next.Patch = v.Patch + 1
+		}
+	case PartPreRelease:
+		if !preRelease {
+			next.Patch = v.Patch + 1
+			next.PreRelease = []string{"0"}
+			break
+		}
+
+		next.PreRelease = append([]string{}, v.PreRelease...)
+		last := len(next.PreRelease) - 1
+		if n, err := strconv.ParseUint(next.PreRelease[last], 10, 64); err == nil {
+			next.PreRelease[last] = strconv.FormatUint(n+1, 10)
+		} else {
+			next.PreRelease = append(next.PreRelease, "0")
+		}
+	default:
+		return nil, errors.Wrapf(ErrInvalidPart, "'%s'", part)
+	}
+
+	return next, nil
+}
@@ -0,0 +1,79 @@
+package semver_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/mage-loot/semver"
+)
+
+func TestParse(t *testing.T) {
+	assert := require.New(t)
+
+	v, err := semver.Parse("v1.2.3-rc.1+build.5")
+	assert.NoError(err)
+	assert.Equal(uint64(1), v.Major)
+	assert.Equal(uint64(2), v.Minor)
+	assert.Equal(uint64(3), v.Patch)
+	assert.Equal([]string{"rc", "1"}, v.PreRelease)
+	assert.Equal([]string{"build", "5"}, v.Build)
+	assert.Equal("1.2.3-rc.1+build.5", v.String())
+
+	for _, invalid := range []string{"", "1.2", "1.2.3.4", "01.2.3", "1.2.3-", "1.2.3-01", "latest"} {
+		_, err := semver.Parse(invalid)
+		assert.ErrorIs(err, semver.ErrInvalidVersion, invalid)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	assert := require.New(t)
+
+	// Ordered by precedence, from the spec.
+	ordered := []string{
+		"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta",
+		"1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.1.0", "2.0.0",
+	}
+
+	for i := 0; i < len(ordered)-1; i++ {
+		c, err := semver.Compare(ordered[i], ordered[i+1])
+		assert.NoError(err)
+		assert.Equal(-1, c, "%s < %s", ordered[i], ordered[i+1])
+
+		c, err = semver.Compare(ordered[i+1], ordered[i])
+		assert.NoError(err)
+		assert.Equal(1, c, "%s > %s", ordered[i+1], ordered[i])
+	}
+
+	c, err := semver.Compare("v1.2.3+a", "1.2.3+b")
+	assert.NoError(err)
+	assert.Equal(0, c)
+}
+
+func TestNext(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		version, part, next string
+	}{
+		{"1.2.3", semver.PartMajor, "2.0.0"},
+		{"1.2.3", semver.PartMinor, "1.3.0"},
+		{"1.2.3+build", semver.PartPatch, "1.2.4"},
+		{"1.2.3", semver.PartPreRelease, "1.2.4-0"},
+		{"2.0.0-rc.1", semver.PartMajor, "2.0.0"},
+		{"1.3.0-rc.1", semver.PartMinor, "1.3.0"},
+		{"1.3.1-rc.1", semver.PartMinor, "1.4.0"},
+		{"1.2.4-rc.1", semver.PartPatch, "1.2.4"},
+		{"1.2.4-rc.1", semver.PartPreRelease, "1.2.4-rc.2"},
+		{"1.2.4-beta", semver.PartPreRelease, "1.2.4-beta.0"},
+	}
+
+	for _, tt := range tests {
+		next, err := semver.MustParse(tt.version).Next(tt.part)
+		assert.NoError(err)
+		assert.Equal(tt.next, next.String(), tt.version+" "+tt.part)
+	}
+
+	_, err := semver.MustParse("1.2.3").Next("micro")
+	assert.ErrorIs(err, semver.ErrInvalidPart)
+}